@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"api-gateway/internal/config"
@@ -10,6 +16,9 @@ import (
 	"api-gateway/internal/handlers"
 	"api-gateway/internal/middleware"
 	"api-gateway/internal/services"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 func main() {
@@ -20,30 +29,99 @@ func main() {
 
 	log.Printf("Starting on port %s → %s", cfg.Port, cfg.BackendURL)
 
+	upgrader, err := newUpgrader(cfg.Server.PIDFile)
+	if err != nil {
+		log.Fatalf("Couldn't inherit listeners: %v", err)
+	}
+
 	db, err := database.Connect(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatalf("Database connection failed: %v", err)
 	}
-	defer db.Close()
 
 	rateLimiter, err := services.NewRateLimiter(cfg.RedisURL)
 	if err != nil {
 		log.Fatalf("Redis connection failed: %v", err)
 	}
-	defer rateLimiter.Close()
 
 	cacheService := services.NewCacheService(rateLimiter.GetClient(), 60*time.Second)
 	metricsCollector := services.NewMetricsCollector()
 
-	authMiddleware := middleware.NewAuthMiddleware(db)
+	hmacAuthenticator := middleware.NewHMACAuthenticator(
+		db,
+		services.NewNonceStore(rateLimiter.GetClient()),
+		time.Duration(cfg.HMAC.MaxSkewSeconds)*time.Second,
+		int64(cfg.HMAC.MaxBodyBytes),
+	)
+
+	clientCertAuthenticator, err := middleware.NewClientCertAuthenticator(cfg.ClientCert, cfg.TLS.ClientPrincipalFrom)
+	if err != nil {
+		log.Fatalf("Invalid TLS_CLIENT_PRINCIPAL_FROM: %v", err)
+	}
+
+	authenticators := map[string]middleware.Authenticator{
+		"api_key":       middleware.NewAPIKeyHeaderAuthenticator(db, "X-API-Key"),
+		"api_key_query": middleware.NewAPIKeyQueryAuthenticator(db, cfg.APIKeyQuery),
+		"hmac":          hmacAuthenticator,
+		"mtls":          clientCertAuthenticator,
+		"anonymous":     middleware.NewAnonymousAuthenticator(cfg.Anonymous),
+	}
+	if cfg.JWT.Enabled() {
+		authenticators["jwt"] = middleware.NewJWTAuthenticator(services.NewJWTValidator(cfg.JWT))
+	}
+	if cfg.OAuth2.IntrospectionURL != "" {
+		introspector := services.NewTokenIntrospector(cfg.OAuth2, rateLimiter.GetClient())
+		authenticators["oauth2"] = middleware.NewIntrospectionAuthenticator(introspector)
+	}
+
+	router := services.NewRouter(cfg.Routes)
+	routeMiddleware := middleware.NewRouteMiddleware(router)
+	authMiddleware := middleware.NewAuthMiddleware(authenticators, cfg.AuthMethods)
+	if err := authMiddleware.CheckMethods(cfg.AuthMethods); err != nil {
+		log.Fatalf("Invalid AUTH_METHODS: %v", err)
+	}
+	for _, route := range router.Routes() {
+		if err := authMiddleware.CheckMethods(route.Auth); err != nil {
+			log.Fatalf("Invalid route %s: %v", route.Name, err)
+		}
+		if route.RequireClientCert && (!cfg.TLS.Enabled() || cfg.TLS.ClientCAFile == "") {
+			log.Fatalf("Invalid route %s: require_client_cert needs TLS_CERT_FILES and TLS_CLIENT_CA_FILE", route.Name)
+		}
+		if route.RequireClientCert && (len(route.Auth) > 1 || len(route.Auth) == 1 && route.Auth[0] != "mtls") {
+			log.Fatalf("Invalid route %s: require_client_cert always authenticates with mtls, so auth can only be [\"mtls\"]", route.Name)
+		}
+	}
+	grpcMiddleware := middleware.NewGRPCMiddleware(metricsCollector)
+	limitsMiddleware := middleware.NewLimitsMiddleware(cfg.Server.MaxBodyBytes)
 	rateLimitMiddleware := middleware.NewRateLimitMiddleware(rateLimiter, metricsCollector)
-	cacheMiddleware := middleware.NewCacheMiddleware(cacheService, 60*time.Second, metricsCollector)
+	compressor, err := services.NewCompressor(cfg.Compression)
+	if err != nil {
+		log.Fatalf("Invalid compression config: %v", err)
+	}
+	compressionMiddleware := middleware.NewCompressionMiddleware(compressor)
+	cacheMiddleware := middleware.NewCacheMiddleware(cacheService, 60*time.Second, cfg.Cache.MaxBodyBytes, compressor, metricsCollector)
+
+	proxyService, err := services.NewProxyService(cfg.Upstreams, services.NewIdentityHeaders(cfg.Identity, cfg.APIKeyQuery), cfg.Timeouts, metricsCollector)
+	if err != nil {
+		log.Fatalf("Invalid upstream config: %v", err)
+	}
+	if err := proxyService.LoadRoutes(router.Routes()); err != nil {
+		log.Fatalf("Invalid route config: %v", err)
+	}
+
+	healthChecker := services.NewHealthChecker(proxyService.Upstreams())
+	healthChecker.Start()
 
-	proxyService := services.NewProxyService(cfg.BackendURL)
+	webSocketProxy := services.NewWebSocketProxy(cfg.WebSocket, metricsCollector)
 
-	proxyHandler := handlers.NewProxyHandler(proxyService, db, metricsCollector)
-	adminHandler := handlers.NewAdminHandler(db)
-	metricsHandler := handlers.NewMetricsHandler(metricsCollector, db, rateLimiter)
+	proxyHandler := handlers.NewProxyHandler(proxyService, db, metricsCollector, webSocketProxy)
+	adminHandler := handlers.NewAdminHandler(db, proxyService)
+	drainMiddleware := middleware.NewDrainMiddleware()
+	clientIPMiddleware, err := middleware.NewClientIPMiddleware(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid SERVER_TRUSTED_PROXIES: %v", err)
+	}
+	metricsHandler := handlers.NewMetricsHandler(metricsCollector, db, rateLimiter, proxyService, drainMiddleware)
 
 	mux := http.NewServeMux()
 
@@ -62,17 +140,140 @@ func main() {
 	})
 	mux.HandleFunc("/admin/keys/delete", adminHandler.DeleteAPIKey)
 	mux.HandleFunc("/admin/keys/toggle", adminHandler.ToggleAPIKey)
+	mux.HandleFunc("/admin/circuit-breakers", adminHandler.ListCircuitBreakers)
+	mux.HandleFunc("/admin/circuit-breakers/mode", adminHandler.SetCircuitBreaker)
 
-	mux.Handle("/", authMiddleware.Middleware(rateLimitMiddleware.Middleware(cacheMiddleware.Middleware(proxyHandler))))
+	mux.Handle("/", grpcMiddleware.Middleware(routeMiddleware.Middleware(limitsMiddleware.Middleware(authMiddleware.Middleware(limitsMiddleware.KeyMiddleware(rateLimitMiddleware.Middleware(compressionMiddleware.Middleware(cacheMiddleware.Middleware(proxyHandler)))))))))
 
-	server := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: mux,
+	handler := drainMiddleware.Middleware(middleware.NewRequestIDMiddleware().Middleware(clientIPMiddleware.Middleware(mux)))
+
+	var certStore *services.CertificateStore
+	var servers []*http.Server
+	if cfg.TLS.Enabled() {
+		certStore, err = services.NewCertificateStore(cfg.TLS)
+		if err != nil {
+			log.Fatalf("Invalid TLS config: %v", err)
+		}
+		tlsConfig, err := services.NewServerTLSConfig(cfg.TLS, certStore)
+		if err != nil {
+			log.Fatalf("Invalid TLS config: %v", err)
+		}
+		servers = append(servers, newServer(cfg, ":"+cfg.TLS.Port, handler, tlsConfig))
+
+		switch cfg.TLS.HTTPMode {
+		case "serve":
+			servers = append(servers, newServer(cfg, ":"+cfg.Port, handler, nil))
+		case "redirect":
+			redirectMux := http.NewServeMux()
+			redirectMux.HandleFunc("/health", metricsHandler.HealthCheck)
+			redirectMux.Handle("/", handlers.NewRedirectHandler(cfg.TLS.Port))
+			servers = append(servers, newServer(cfg, ":"+cfg.Port, redirectMux, nil))
+		case "off":
+		default:
+			log.Fatalf("Invalid TLS_HTTP_MODE %q", cfg.TLS.HTTPMode)
+		}
+		certStore.Start()
+	} else {
+		servers = append(servers, newServer(cfg, ":"+cfg.Port, handler, nil))
+	}
+	for _, server := range servers {
+		server.RegisterOnShutdown(webSocketProxy.Shutdown)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	upgradeSignals := make(chan os.Signal, 1)
+	signal.Notify(upgradeSignals, syscall.SIGHUP, syscall.SIGUSR2)
+
+	serverErr := make(chan error, len(servers))
+	for _, server := range servers {
+		listener, err := upgrader.Listen(server.Addr)
+		if err != nil {
+			log.Fatalf("Couldn't listen on %s: %v", server.Addr, err)
+		}
+		go func(server *http.Server, listener net.Listener) {
+			if server.TLSConfig != nil {
+				serverErr <- server.ServeTLS(listener, "", "")
+			} else {
+				serverErr <- server.Serve(listener)
+			}
+		}(server, listener)
 	}
 
+	upgrader.Ready()
 	log.Printf("Ready")
 
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Server error: %v", err)
+	drainDelay := time.Duration(cfg.Server.ShutdownDelaySeconds) * time.Second
+wait:
+	for {
+		select {
+		case err := <-serverErr:
+			log.Fatalf("Server error: %v", err)
+		case <-ctx.Done():
+			break wait
+		case <-upgradeSignals:
+			log.Printf("Upgrading")
+			if err := upgrader.Upgrade(time.Duration(cfg.Server.UpgradeTimeoutSeconds) * time.Second); err != nil {
+				log.Printf("Upgrade failed, still serving: %v", err)
+				continue
+			}
+			// The new process already accepts on the same sockets.
+			drainDelay = 0
+			break wait
+		}
+	}
+	stop()
+	signal.Stop(upgradeSignals)
+
+	log.Printf("Shutting down, draining for %s", drainDelay)
+	drainMiddleware.Drain()
+	time.Sleep(drainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Shutdown deadline exceeded, closing connections: %v", err)
+			server.Close()
+		}
+	}
+	if err := drainMiddleware.Wait(shutdownCtx); err != nil {
+		log.Printf("Shutdown deadline exceeded with %d requests in flight", drainMiddleware.InFlight())
+	}
+
+	healthChecker.Stop()
+	if certStore != nil {
+		certStore.Stop()
+	}
+	if err := db.Close(); err != nil {
+		log.Printf("Couldn't close database: %v", err)
+	}
+	if err := rateLimiter.Close(); err != nil {
+		log.Printf("Couldn't close Redis: %v", err)
+	}
+
+	log.Printf("Stopped")
+}
+
+func newServer(cfg *config.Config, addr string, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeoutSeconds) * time.Second,
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeoutSeconds) * time.Second,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+
+	h2s := &http2.Server{}
+	if cfg.Server.H2C && tlsConfig == nil {
+		server.Handler = h2c.NewHandler(handler, h2s)
+	}
+	if err := http2.ConfigureServer(server, h2s); err != nil {
+		log.Fatalf("Couldn't configure HTTP/2 on %s: %v", addr, err)
 	}
+	return server
 }
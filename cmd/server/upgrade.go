@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	inheritedListenersEnv = "GATEWAY_INHERITED_LISTENERS"
+	upgradeReadyFDEnv     = "GATEWAY_UPGRADE_READY_FD"
+)
+
+// upgrader hands listening sockets to a freshly started copy of the binary,
+// so it can take over without refusing connections while this one drains.
+type upgrader struct {
+	pidFile string
+
+	mu        sync.Mutex
+	inherited map[string]net.Listener
+	addrs     []string
+	listeners []*net.TCPListener
+	upgrading bool
+}
+
+func newUpgrader(pidFile string) (*upgrader, error) {
+	u := &upgrader{
+		pidFile:   pidFile,
+		inherited: make(map[string]net.Listener),
+	}
+
+	value := os.Getenv(inheritedListenersEnv)
+	os.Unsetenv(inheritedListenersEnv)
+	if value == "" {
+		return u, nil
+	}
+
+	for i, addr := range strings.Split(value, ",") {
+		file := os.NewFile(uintptr(3+i), addr)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inherited listener %s: %w", addr, err)
+		}
+		u.inherited[addr] = listener
+	}
+	log.Printf("Inherited %d listeners from pid %d", len(u.inherited), os.Getppid())
+	return u, nil
+}
+
+// Listen returns the inherited socket for addr if there is one, and opens a
+// new one otherwise.
+func (u *upgrader) Listen(addr string) (net.Listener, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	listener, ok := u.inherited[addr]
+	if ok {
+		delete(u.inherited, addr)
+	} else {
+		var err error
+		if listener, err = net.Listen("tcp", addr); err != nil {
+			return nil, err
+		}
+	}
+
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		listener.Close()
+		return nil, fmt.Errorf("listener for %s is not TCP", addr)
+	}
+	u.addrs = append(u.addrs, addr)
+	u.listeners = append(u.listeners, tcpListener)
+	return listener, nil
+}
+
+// Ready closes inherited sockets the new config no longer uses, writes the
+// PID file and tells the parent it can start draining.
+func (u *upgrader) Ready() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for addr, listener := range u.inherited {
+		log.Printf("Closing unused inherited listener %s", addr)
+		listener.Close()
+		delete(u.inherited, addr)
+	}
+
+	if u.pidFile != "" {
+		if err := os.WriteFile(u.pidFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+			log.Printf("Couldn't write PID file: %v", err)
+		}
+	}
+
+	value := os.Getenv(upgradeReadyFDEnv)
+	os.Unsetenv(upgradeReadyFDEnv)
+	if fd, err := strconv.Atoi(value); err == nil {
+		ready := os.NewFile(uintptr(fd), "upgrade-ready")
+		ready.Write([]byte{1})
+		ready.Close()
+	}
+}
+
+// Upgrade starts a new process with the current listeners and waits for it
+// to report ready. If it fails, the new process is killed and this one keeps
+// serving.
+func (u *upgrader) Upgrade(timeout time.Duration) error {
+	u.mu.Lock()
+	if u.upgrading {
+		u.mu.Unlock()
+		return fmt.Errorf("upgrade already in progress")
+	}
+	u.upgrading = true
+	files, err := u.listenerFiles()
+	addrs := strings.Join(u.addrs, ",")
+	u.mu.Unlock()
+
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+		u.mu.Lock()
+		u.upgrading = false
+		u.mu.Unlock()
+	}()
+	if err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = append(files, readyW)
+	cmd.Env = append(os.Environ(),
+		inheritedListenersEnv+"="+addrs,
+		upgradeReadyFDEnv+"="+strconv.Itoa(3+len(files)),
+	)
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return fmt.Errorf("couldn't start new process: %w", err)
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		_, err := readyR.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			cmd.Wait()
+			return fmt.Errorf("new process exited before it was ready")
+		}
+	case <-time.After(timeout):
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("new process wasn't ready after %s", timeout)
+	}
+
+	log.Printf("Handed listeners to pid %d", cmd.Process.Pid)
+	return cmd.Process.Release()
+}
+
+func (u *upgrader) listenerFiles() ([]*os.File, error) {
+	files := make([]*os.File, 0, len(u.listeners))
+	for _, listener := range u.listeners {
+		file, err := listener.File()
+		if err != nil {
+			return files, fmt.Errorf("couldn't duplicate listener: %w", err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const DefaultUpstream = "default"
+
+type RouteConfig struct {
+	Name       string   `json:"name"`
+	PathPrefix string   `json:"path_prefix"`
+	Methods    []string `json:"methods,omitempty"`
+	Auth       []string `json:"auth,omitempty"`
+	Upstream   string   `json:"upstream,omitempty"`
+
+	RequireClientCert    bool `json:"require_client_cert,omitempty"`
+	AllowUnsignedPayload bool `json:"allow_unsigned_payload,omitempty"`
+
+	Timeouts *TimeoutConfig `json:"timeouts,omitempty"`
+	Retry    *RetryConfig   `json:"retry,omitempty"`
+	Hedge    *HedgeConfig   `json:"hedge,omitempty"`
+	Limits   *LimitsConfig  `json:"limits,omitempty"`
+
+	Transcode *TranscodeConfig `json:"transcode,omitempty"`
+	Rewrite   *RewriteConfig   `json:"rewrite,omitempty"`
+	Headers   *HeadersConfig   `json:"headers,omitempty"`
+	Body      *BodyConfig      `json:"body,omitempty"`
+
+	FlushIntervalMs int `json:"flush_interval_ms,omitempty"`
+}
+
+type LimitsConfig struct {
+	MaxBodyBytes   int64 `json:"max_body_bytes,omitempty"`
+	MaxHeaderBytes int   `json:"max_header_bytes,omitempty"`
+	MaxURLLength   int   `json:"max_url_length,omitempty"`
+}
+
+type HedgeConfig struct {
+	Percentile float64 `json:"percentile,omitempty"`
+	DelayMs    int     `json:"delay_ms,omitempty"`
+	MinSamples int     `json:"min_samples,omitempty"`
+}
+
+type RetryConfig struct {
+	MaxAttempts        int      `json:"max_attempts"`
+	Methods            []string `json:"methods,omitempty"`
+	RetryOnStatus      []int    `json:"retry_on_status,omitempty"`
+	RetryOnErrors      *bool    `json:"retry_on_errors,omitempty"`
+	BackoffBaseMs      int      `json:"backoff_base_ms,omitempty"`
+	BackoffMaxMs       int      `json:"backoff_max_ms,omitempty"`
+	BudgetPercent      float64  `json:"budget_percent,omitempty"`
+	BudgetMinPerSecond int      `json:"budget_min_per_second,omitempty"`
+	MaxBodyBytes       int64    `json:"max_body_bytes,omitempty"`
+}
+
+type TimeoutConfig struct {
+	ConnectMs        int `json:"connect_ms,omitempty"`
+	TLSHandshakeMs   int `json:"tls_handshake_ms,omitempty"`
+	ResponseHeaderMs int `json:"response_header_ms,omitempty"`
+	TotalMs          int `json:"total_ms,omitempty"`
+}
+
+func (t TimeoutConfig) Merge(override *TimeoutConfig) TimeoutConfig {
+	if override == nil {
+		return t
+	}
+	if override.ConnectMs > 0 {
+		t.ConnectMs = override.ConnectMs
+	}
+	if override.TLSHandshakeMs > 0 {
+		t.TLSHandshakeMs = override.TLSHandshakeMs
+	}
+	if override.ResponseHeaderMs > 0 {
+		t.ResponseHeaderMs = override.ResponseHeaderMs
+	}
+	if override.TotalMs > 0 {
+		t.TotalMs = override.TotalMs
+	}
+	return t
+}
+
+type HeadersConfig struct {
+	Request  *HeaderRulesConfig `json:"request,omitempty"`
+	Response *HeaderRulesConfig `json:"response,omitempty"`
+}
+
+type HeaderRulesConfig struct {
+	Add    map[string]string `json:"add,omitempty"`
+	Set    map[string]string `json:"set,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+	Rename map[string]string `json:"rename,omitempty"`
+}
+
+type BodyConfig struct {
+	Request  *BodyTransformConfig `json:"request,omitempty"`
+	Response *BodyTransformConfig `json:"response,omitempty"`
+}
+
+type BodyTransformConfig struct {
+	Unwrap       string            `json:"unwrap,omitempty"`
+	Project      map[string]string `json:"project,omitempty"`
+	Allow        []string          `json:"allow,omitempty"`
+	Deny         []string          `json:"deny,omitempty"`
+	Rename       map[string]string `json:"rename,omitempty"`
+	Wrap         string            `json:"wrap,omitempty"`
+	MaxBodyBytes int64             `json:"max_body_bytes,omitempty"`
+}
+
+type RewriteConfig struct {
+	StripPrefix bool                    `json:"strip_prefix,omitempty"`
+	AddPrefix   string                  `json:"add_prefix,omitempty"`
+	Regex       []RegexRewriteConfig    `json:"regex,omitempty"`
+	Templates   []TemplateRewriteConfig `json:"templates,omitempty"`
+	Query       *QueryRewriteConfig     `json:"query,omitempty"`
+}
+
+type RegexRewriteConfig struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+type TemplateRewriteConfig struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type QueryRewriteConfig struct {
+	Add    map[string]string `json:"add,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+	Rename map[string]string `json:"rename,omitempty"`
+}
+
+type TranscodeConfig struct {
+	DescriptorSet string   `json:"descriptor_set"`
+	Services      []string `json:"services,omitempty"`
+}
+
+type UpstreamConfig struct {
+	Name             string                  `json:"name"`
+	Strategy         string                  `json:"strategy,omitempty"`
+	Protocol         string                  `json:"protocol,omitempty"`
+	HashOn           string                  `json:"hash_on,omitempty"`
+	Targets          []TargetConfig          `json:"targets"`
+	HealthCheck      *HealthCheckConfig      `json:"health_check,omitempty"`
+	OutlierDetection *OutlierDetectionConfig `json:"outlier_detection,omitempty"`
+	CircuitBreaker   *CircuitBreakerConfig   `json:"circuit_breaker,omitempty"`
+	TLS              *UpstreamTLSConfig      `json:"tls,omitempty"`
+}
+
+type UpstreamTLSConfig struct {
+	CAFile     string `json:"ca_file,omitempty"`
+	CertFile   string `json:"cert_file,omitempty"`
+	KeyFile    string `json:"key_file,omitempty"`
+	ServerName string `json:"server_name,omitempty"`
+}
+
+type HealthCheckConfig struct {
+	Path               string `json:"path"`
+	IntervalSeconds    int    `json:"interval_seconds,omitempty"`
+	TimeoutSeconds     int    `json:"timeout_seconds,omitempty"`
+	ExpectedStatus     int    `json:"expected_status,omitempty"`
+	HealthyThreshold   int    `json:"healthy_threshold,omitempty"`
+	UnhealthyThreshold int    `json:"unhealthy_threshold,omitempty"`
+}
+
+type CircuitBreakerConfig struct {
+	ErrorRateThreshold    float64 `json:"error_rate_threshold,omitempty"`
+	SlowCallMs            int     `json:"slow_call_ms,omitempty"`
+	SlowCallRateThreshold float64 `json:"slow_call_rate_threshold,omitempty"`
+	MinRequests           int     `json:"min_requests,omitempty"`
+	WindowSeconds         int     `json:"window_seconds,omitempty"`
+	OpenSeconds           int     `json:"open_seconds,omitempty"`
+	HalfOpenRequests      int     `json:"half_open_requests,omitempty"`
+}
+
+type OutlierDetectionConfig struct {
+	ConsecutiveFailures int `json:"consecutive_failures,omitempty"`
+	EjectionSeconds     int `json:"ejection_seconds,omitempty"`
+}
+
+type TargetConfig struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+type fileConfig struct {
+	Upstreams []UpstreamConfig `json:"upstreams"`
+	Routes    []RouteConfig    `json:"routes"`
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("couldn't read config file: %w", err)
+	}
+
+	var fc fileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return fmt.Errorf("invalid config file: %w", err)
+	}
+
+	upstreams := make(map[string]bool)
+	for i, upstream := range fc.Upstreams {
+		if upstream.Name == "" {
+			return fmt.Errorf("upstream %d has no name", i)
+		}
+		if len(upstream.Targets) == 0 {
+			return fmt.Errorf("upstream %s has no targets", upstream.Name)
+		}
+		upstreams[upstream.Name] = true
+	}
+
+	for i, route := range fc.Routes {
+		if route.PathPrefix == "" {
+			return fmt.Errorf("route %d has no path_prefix", i)
+		}
+		if route.Name == "" {
+			fc.Routes[i].Name = route.PathPrefix
+		}
+		if route.Upstream != "" && route.Upstream != DefaultUpstream && !upstreams[route.Upstream] {
+			return fmt.Errorf("route %s uses unknown upstream %s", fc.Routes[i].Name, route.Upstream)
+		}
+	}
+
+	cfg.Upstreams = fc.Upstreams
+	cfg.Routes = fc.Routes
+	return nil
+}
+
+func defaultUpstream(backendURL string) UpstreamConfig {
+	return UpstreamConfig{
+		Name:    DefaultUpstream,
+		Targets: []TargetConfig{{URL: backendURL}},
+	}
+}
+
+func defaultRoutes() []RouteConfig {
+	return []RouteConfig{
+		{Name: "default", PathPrefix: "/"},
+	}
+}
@@ -64,7 +64,7 @@ func (db *DB) LogRequest(log *models.RequestLog) error {
 
 func (db *DB) GetAPIKeyByKey(key string) (*models.APIKey, error) {
 	query := `
-		SELECT id, key, name, rate_limit_per_minute, rate_limit_per_hour, is_active, created_at
+		SELECT id, key, name, COALESCE(signing_secret, ''), rate_limit_per_minute, rate_limit_per_hour, COALESCE(max_body_bytes, 0), is_active, created_at
 		FROM api_keys
 		WHERE key = $1 AND is_active = true
 	`
@@ -74,8 +74,40 @@ func (db *DB) GetAPIKeyByKey(key string) (*models.APIKey, error) {
 		&apiKey.ID,
 		&apiKey.Key,
 		&apiKey.Name,
+		&apiKey.SigningSecret,
 		&apiKey.RateLimitPerMinute,
 		&apiKey.RateLimitPerHour,
+		&apiKey.MaxBodyBytes,
+		&apiKey.IsActive,
+		&apiKey.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return apiKey, nil
+}
+
+func (db *DB) GetAPIKeyByID(id uuid.UUID) (*models.APIKey, error) {
+	query := `
+		SELECT id, key, name, COALESCE(signing_secret, ''), rate_limit_per_minute, rate_limit_per_hour, COALESCE(max_body_bytes, 0), is_active, created_at
+		FROM api_keys
+		WHERE id = $1 AND is_active = true
+	`
+
+	apiKey := &models.APIKey{}
+	err := db.conn.QueryRow(query, id).Scan(
+		&apiKey.ID,
+		&apiKey.Key,
+		&apiKey.Name,
+		&apiKey.SigningSecret,
+		&apiKey.RateLimitPerMinute,
+		&apiKey.RateLimitPerHour,
+		&apiKey.MaxBodyBytes,
 		&apiKey.IsActive,
 		&apiKey.CreatedAt,
 	)
@@ -92,8 +124,8 @@ func (db *DB) GetAPIKeyByKey(key string) (*models.APIKey, error) {
 
 func (db *DB) CreateAPIKey(apiKey *models.APIKey) error {
 	query := `
-		INSERT INTO api_keys (key, name, rate_limit_per_minute, rate_limit_per_hour, is_active, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO api_keys (key, name, signing_secret, rate_limit_per_minute, rate_limit_per_hour, max_body_bytes, is_active, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), $7, $8)
 		RETURNING id
 	`
 
@@ -101,8 +133,10 @@ func (db *DB) CreateAPIKey(apiKey *models.APIKey) error {
 		query,
 		apiKey.Key,
 		apiKey.Name,
+		apiKey.SigningSecret,
 		apiKey.RateLimitPerMinute,
 		apiKey.RateLimitPerHour,
+		apiKey.MaxBodyBytes,
 		apiKey.IsActive,
 		time.Now(),
 	).Scan(&apiKey.ID)
@@ -116,7 +150,7 @@ func (db *DB) CreateAPIKey(apiKey *models.APIKey) error {
 
 func (db *DB) ListAPIKeys() ([]models.APIKey, error) {
 	query := `
-		SELECT id, key, name, rate_limit_per_minute, rate_limit_per_hour, is_active, created_at
+		SELECT id, key, name, COALESCE(signing_secret, ''), rate_limit_per_minute, rate_limit_per_hour, COALESCE(max_body_bytes, 0), is_active, created_at
 		FROM api_keys
 		ORDER BY created_at DESC
 	`
@@ -134,8 +168,10 @@ func (db *DB) ListAPIKeys() ([]models.APIKey, error) {
 			&apiKey.ID,
 			&apiKey.Key,
 			&apiKey.Name,
+			&apiKey.SigningSecret,
 			&apiKey.RateLimitPerMinute,
 			&apiKey.RateLimitPerHour,
+			&apiKey.MaxBodyBytes,
 			&apiKey.IsActive,
 			&apiKey.CreatedAt,
 		)
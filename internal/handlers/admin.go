@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -9,20 +11,26 @@ import (
 	"github.com/google/uuid"
 	"api-gateway/internal/database"
 	"api-gateway/internal/models"
+	"api-gateway/internal/services"
 )
 
 type AdminHandler struct {
-	db *database.DB
+	db           *database.DB
+	proxyService *services.ProxyService
 }
 
-func NewAdminHandler(db *database.DB) *AdminHandler {
-	return &AdminHandler{db: db}
+func NewAdminHandler(db *database.DB, proxyService *services.ProxyService) *AdminHandler {
+	return &AdminHandler{
+		db:           db,
+		proxyService: proxyService,
+	}
 }
 
 type CreateAPIKeyRequest struct {
 	Name               string `json:"name"`
 	RateLimitPerMinute int    `json:"rate_limit_per_minute"`
 	RateLimitPerHour   int    `json:"rate_limit_per_hour"`
+	MaxBodyBytes       int64  `json:"max_body_bytes"`
 }
 
 func (h *AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
@@ -48,11 +56,20 @@ func (h *AdminHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
 		req.RateLimitPerHour = 5000
 	}
 
+	signingSecret := make([]byte, 32)
+	if _, err := rand.Read(signingSecret); err != nil {
+		log.Printf("Couldn't generate signing secret: %v", err)
+		http.Error(w, `{"error":"Couldn't create API key"}`, http.StatusInternalServerError)
+		return
+	}
+
 	apiKey := &models.APIKey{
 		Key:                uuid.New().String(),
 		Name:               req.Name,
+		SigningSecret:      hex.EncodeToString(signingSecret),
 		RateLimitPerMinute: req.RateLimitPerMinute,
 		RateLimitPerHour:   req.RateLimitPerHour,
+		MaxBodyBytes:       req.MaxBodyBytes,
 		IsActive:           true,
 		CreatedAt:          time.Now(),
 	}
@@ -142,3 +159,40 @@ func (h *AdminHandler) ToggleAPIKey(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "API key toggled successfully"})
 }
+
+func (h *AdminHandler) ListCircuitBreakers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.proxyService.CircuitBreakerStatus())
+}
+
+func (h *AdminHandler) SetCircuitBreaker(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.URL.Query().Get("upstream")
+	if name == "" {
+		http.Error(w, `{"error":"upstream parameter is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	upstream, ok := h.proxyService.Upstreams()[name]
+	if !ok || upstream.CircuitBreaker() == nil {
+		http.Error(w, `{"error":"No circuit breaker for upstream"}`, http.StatusNotFound)
+		return
+	}
+
+	if err := upstream.CircuitBreaker().SetMode(r.URL.Query().Get("mode")); err != nil {
+		http.Error(w, `{"error":"mode must be auto, forced_open or forced_closed"}`, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(upstream.CircuitBreaker().Status())
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"api-gateway/internal/database"
+	"api-gateway/internal/middleware"
 	"api-gateway/internal/services"
 )
 
@@ -14,13 +15,17 @@ type MetricsHandler struct {
 	metricsCollector *services.MetricsCollector
 	db               *database.DB
 	rateLimiter      *services.RateLimiter
+	proxyService     *services.ProxyService
+	drain            *middleware.DrainMiddleware
 }
 
-func NewMetricsHandler(metricsCollector *services.MetricsCollector, db *database.DB, rateLimiter *services.RateLimiter) *MetricsHandler {
+func NewMetricsHandler(metricsCollector *services.MetricsCollector, db *database.DB, rateLimiter *services.RateLimiter, proxyService *services.ProxyService, drain *middleware.DrainMiddleware) *MetricsHandler {
 	return &MetricsHandler{
 		metricsCollector: metricsCollector,
 		db:               db,
 		rateLimiter:      rateLimiter,
+		proxyService:     proxyService,
+		drain:            drain,
 	}
 }
 
@@ -31,15 +36,17 @@ func (h *MetricsHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
 	}
 
 	snapshot := h.metricsCollector.GetSnapshot()
+	snapshot.CircuitBreakers = h.proxyService.CircuitBreakerStatus()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(snapshot)
 }
 
 type HealthResponse struct {
-	Status    string            `json:"status"`
-	Timestamp string            `json:"timestamp"`
-	Services  map[string]string `json:"services"`
+	Status    string                             `json:"status"`
+	Timestamp string                             `json:"timestamp"`
+	Services  map[string]string                  `json:"services"`
+	Upstreams map[string]services.UpstreamHealth `json:"upstreams"`
 }
 
 func (h *MetricsHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
@@ -55,6 +62,7 @@ func (h *MetricsHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		Status:    "healthy",
 		Timestamp: time.Now().Format(time.RFC3339),
 		Services:  make(map[string]string),
+		Upstreams: make(map[string]services.UpstreamHealth),
 	}
 
 	if err := h.checkPostgreSQL(ctx); err != nil {
@@ -71,8 +79,16 @@ func (h *MetricsHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		health.Services["redis"] = "ok"
 	}
 
+	for name, upstream := range h.proxyService.Upstreams() {
+		health.Upstreams[name] = upstream.Health()
+	}
+
+	if h.drain.Draining() {
+		health.Status = "draining"
+	}
+
 	statusCode := http.StatusOK
-	if health.Status == "degraded" {
+	if health.Status != "healthy" {
 		statusCode = http.StatusServiceUnavailable
 	}
 
@@ -1,10 +1,11 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"strings"
 	"time"
 
 	"api-gateway/internal/database"
@@ -13,38 +14,131 @@ import (
 	"api-gateway/internal/services"
 )
 
+const statusClientClosedRequest = 499
+
 type ProxyHandler struct {
 	proxyService     *services.ProxyService
 	db               *database.DB
 	metricsCollector *services.MetricsCollector
+	webSocketProxy   *services.WebSocketProxy
 }
 
-func NewProxyHandler(proxyService *services.ProxyService, db *database.DB, metricsCollector *services.MetricsCollector) *ProxyHandler {
+func NewProxyHandler(proxyService *services.ProxyService, db *database.DB, metricsCollector *services.MetricsCollector, webSocketProxy *services.WebSocketProxy) *ProxyHandler {
 	return &ProxyHandler{
 		proxyService:     proxyService,
 		db:               db,
 		metricsCollector: metricsCollector,
+		webSocketProxy:   webSocketProxy,
 	}
 }
 
 func (h *ProxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
-	resp, err := h.proxyService.ForwardRequest(r)
+	var lease *services.WebSocketLease
+	if services.IsWebSocketUpgrade(r) {
+		var err error
+		lease, err = h.webSocketProxy.Acquire(middleware.GetPrincipalFromContext(r.Context()))
+		if err != nil {
+			h.logRequest(r, http.StatusTooManyRequests, time.Since(start), err.Error())
+			http.Error(w, `{"error":"Too many WebSocket connections"}`, http.StatusTooManyRequests)
+			return
+		}
+		defer lease.Release()
+	}
+
+	// Uploads and gRPC streams can outlast the server's read and write
+	// timeouts, so they're bounded by the upstream timeouts instead.
+	if services.IsGRPCRequest(r) || r.Body != nil && r.Body != http.NoBody {
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Time{})
+		rc.SetWriteDeadline(time.Time{})
+	}
+
+	route := middleware.GetRouteFromContext(r.Context())
+	forward := h.proxyService.ForwardRequest
+	if route != nil && route.Transcode != nil {
+		forward = h.proxyService.ForwardTranscoded
+	}
+
+	principal := middleware.GetPrincipalFromContext(r.Context())
+	resp, err := forward(r, route, principal)
 	if err != nil {
-		h.logRequest(r, http.StatusBadGateway, time.Since(start), "error")
-		http.Error(w, "Bad Gateway: "+err.Error(), http.StatusBadGateway)
+		if r.Context().Err() != nil {
+			h.logRequest(r, statusClientClosedRequest, time.Since(start), "client disconnected")
+			return
+		}
+		var requestErr *services.RequestError
+		if errors.As(err, &requestErr) {
+			h.logRequest(r, requestErr.Status, time.Since(start), err.Error())
+			http.Error(w, fmt.Sprintf(`{"error":%q}`, requestErr.Message), requestErr.Status)
+			return
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.logRequest(r, http.StatusRequestEntityTooLarge, time.Since(start), err.Error())
+			http.Error(w, `{"error":"Request body too large"}`, http.StatusRequestEntityTooLarge)
+			return
+		}
+		if errors.Is(err, services.ErrRequestBody) {
+			h.logRequest(r, http.StatusBadRequest, time.Since(start), err.Error())
+			http.Error(w, `{"error":"Couldn't read request body"}`, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrCircuitOpen) {
+			h.logRequest(r, http.StatusServiceUnavailable, time.Since(start), err.Error())
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, `{"error":"Upstream unavailable"}`)
+			return
+		}
+		if errors.Is(err, services.ErrUpstreamTimeout) {
+			h.metricsCollector.RecordUpstreamTimeout()
+			h.logRequest(r, http.StatusGatewayTimeout, time.Since(start), err.Error())
+			http.Error(w, `{"error":"Gateway Timeout"}`, http.StatusGatewayTimeout)
+			return
+		}
+		h.metricsCollector.RecordUpstreamError()
+		h.logRequest(r, http.StatusBadGateway, time.Since(start), err.Error())
+		http.Error(w, `{"error":"Bad Gateway"}`, http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
-	err = h.proxyService.CopyResponse(w, resp)
+	h.proxyService.ApplyResponseHeaders(resp, r, route, principal)
+	h.proxyService.TransformResponse(resp, route)
+
+	if lease != nil && resp.StatusCode == http.StatusSwitchingProtocols {
+		h.logRequest(r, resp.StatusCode, time.Since(start), "")
+		if err := h.webSocketProxy.Proxy(w, resp, lease); err != nil {
+			log.Printf("WebSocket proxy error: %v", err)
+		}
+		return
+	}
+
+	var flushInterval time.Duration
+	if route != nil {
+		flushInterval = time.Duration(route.FlushIntervalMs) * time.Millisecond
+	}
+
+	err = h.proxyService.CopyResponse(w, resp, flushInterval)
 	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			h.metricsCollector.RecordUpstreamTimeout()
+			h.logRequest(r, resp.StatusCode, time.Since(start), "upstream timeout while copying response")
+			return
+		}
 		h.logRequest(r, http.StatusInternalServerError, time.Since(start), "error copying response")
 		return
 	}
 
-	h.logRequest(r, resp.StatusCode, time.Since(start), "")
+	var detail string
+	if services.IsGRPCRequest(r) {
+		if status := services.GRPCStatus(w.Header()); status != "" {
+			detail = fmt.Sprintf("grpc-status=%s %s", status, services.GRPCCodeName(status))
+		}
+	}
+	h.logRequest(r, resp.StatusCode, time.Since(start), detail)
 }
 
 func (h *ProxyHandler) logRequest(r *http.Request, status int, duration time.Duration, errMsg string) {
@@ -59,9 +153,9 @@ func (h *ProxyHandler) logRequest(r *http.Request, status int, duration time.Dur
 		durationMs,
 	)
 
-	apiKey := middleware.GetAPIKeyFromContext(r.Context())
-	if apiKey != nil {
-		logMsg += fmt.Sprintf(" | %s", apiKey.Name)
+	principal := middleware.GetPrincipalFromContext(r.Context())
+	if principal != nil {
+		logMsg += fmt.Sprintf(" | %s", principal.Name)
 	}
 
 	if errMsg != "" {
@@ -76,12 +170,12 @@ func (h *ProxyHandler) logRequest(r *http.Request, status int, duration time.Dur
 		Path:           r.URL.Path,
 		StatusCode:     status,
 		ResponseTimeMs: int(durationMs),
-		IPAddress:      getClientIP(r),
+		IPAddress:      middleware.ClientIP(r),
 		UserAgent:      r.UserAgent(),
 	}
 
-	if apiKey != nil {
-		requestLog.APIKeyID = &apiKey.ID
+	if principal != nil {
+		requestLog.APIKeyID = principal.APIKeyID
 	}
 
 	if err := h.db.LogRequest(requestLog); err != nil {
@@ -90,22 +184,3 @@ func (h *ProxyHandler) logRequest(r *http.Request, status int, duration time.Dur
 
 	h.metricsCollector.RecordRequest(int(durationMs), status)
 }
-
-func getClientIP(r *http.Request) string {
-	forwarded := r.Header.Get("X-Forwarded-For")
-	if forwarded != "" {
-		ips := strings.Split(forwarded, ",")
-		return strings.TrimSpace(ips[0])
-	}
-
-	realIP := r.Header.Get("X-Real-IP")
-	if realIP != "" {
-		return realIP
-	}
-
-	ip := r.RemoteAddr
-	if idx := strings.LastIndex(ip, ":"); idx != -1 {
-		ip = ip[:idx]
-	}
-	return ip
-}
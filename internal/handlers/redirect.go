@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+type RedirectHandler struct {
+	httpsPort string
+}
+
+func NewRedirectHandler(httpsPort string) *RedirectHandler {
+	return &RedirectHandler{
+		httpsPort: httpsPort,
+	}
+}
+
+func (h *RedirectHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	if host == "" {
+		http.Error(w, `{"error":"Missing Host header"}`, http.StatusBadRequest)
+		return
+	}
+	if h.httpsPort != "443" {
+		host = net.JoinHostPort(host, h.httpsPort)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	target := "https://" + host + r.URL.RequestURI()
+	http.Redirect(w, r, target, http.StatusPermanentRedirect)
+}
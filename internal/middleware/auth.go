@@ -2,60 +2,117 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strings"
 
-	"api-gateway/internal/database"
 	"api-gateway/internal/models"
 )
 
 type contextKey string
 
-const APIKeyContextKey contextKey = "api_key"
+const PrincipalContextKey contextKey = "principal"
 
 type AuthMiddleware struct {
-	db *database.DB
+	authenticators map[string]Authenticator
+	defaultMethods []string
 }
 
-func NewAuthMiddleware(db *database.DB) *AuthMiddleware {
-	return &AuthMiddleware{db: db}
+func NewAuthMiddleware(authenticators map[string]Authenticator, defaultMethods []string) *AuthMiddleware {
+	return &AuthMiddleware{
+		authenticators: authenticators,
+		defaultMethods: defaultMethods,
+	}
+}
+
+func (m *AuthMiddleware) CheckMethods(methods []string) error {
+	for _, method := range methods {
+		if _, ok := m.authenticators[method]; !ok {
+			return fmt.Errorf("auth method %q is not configured", method)
+		}
+	}
+	return nil
 }
 
 func (m *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		apiKey := r.Header.Get("X-API-Key")
-		if apiKey == "" {
-			http.Error(w, `{"error":"Missing API key"}`, http.StatusUnauthorized)
-			return
+		methods := m.defaultMethods
+		if route := GetRouteFromContext(r.Context()); route != nil {
+			if route.RequireClientCert {
+				if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+					writeAuthError(w, "Client certificate required")
+					return
+				}
+				methods = []string{"mtls"}
+			} else if len(route.Auth) > 0 {
+				methods = route.Auth
+			}
 		}
 
-		key, err := m.db.GetAPIKeyByKey(apiKey)
-		if err != nil {
-			log.Printf("Auth DB error: %v", err)
-			http.Error(w, `{"error":"Internal error"}`, http.StatusInternalServerError)
-			return
-		}
+		for _, method := range methods {
+			principal, err := m.authenticators[method].Authenticate(r)
+			if errors.Is(err, ErrNoCredentials) {
+				continue
+			}
 
-		if key == nil {
-			http.Error(w, `{"error":"Invalid API key"}`, http.StatusUnauthorized)
-			return
-		}
+			var authErr *AuthError
+			if errors.As(err, &authErr) {
+				writeAuthError(w, authErr.Message)
+				return
+			}
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, `{"error":"Request body too large"}`, http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				log.Printf("Auth error (%s): %v", method, err)
+				http.Error(w, `{"error":"Internal error"}`, http.StatusInternalServerError)
+				return
+			}
 
-		if !key.IsActive {
-			http.Error(w, `{"error":"API key inactive"}`, http.StatusUnauthorized)
+			principal.AuthMethod = method
+			ctx := context.WithValue(r.Context(), PrincipalContextKey, principal)
+			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), APIKeyContextKey, key)
-		r = r.WithContext(ctx)
-
-		next.ServeHTTP(w, r)
+		writeAuthError(w, "Missing credentials")
 	})
 }
 
-func GetAPIKeyFromContext(ctx context.Context) *models.APIKey {
-	if key, ok := ctx.Value(APIKeyContextKey).(*models.APIKey); ok {
-		return key
+func writeAuthError(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	fmt.Fprintf(w, `{"error":%q}`, message)
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+func principalFromAPIKey(key *models.APIKey) *models.Principal {
+	return &models.Principal{
+		ID:                 key.ID.String(),
+		Type:               "api_key",
+		Name:               key.Name,
+		APIKeyID:           &key.ID,
+		RateLimitPerMinute: key.RateLimitPerMinute,
+		RateLimitPerHour:   key.RateLimitPerHour,
+		MaxBodyBytes:       key.MaxBodyBytes,
+	}
+}
+
+func GetPrincipalFromContext(ctx context.Context) *models.Principal {
+	if principal, ok := ctx.Value(PrincipalContextKey).(*models.Principal); ok {
+		return principal
 	}
 	return nil
 }
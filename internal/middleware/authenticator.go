@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/database"
+	"api-gateway/internal/models"
+	"api-gateway/internal/services"
+)
+
+type Authenticator interface {
+	Authenticate(r *http.Request) (*models.Principal, error)
+}
+
+var ErrNoCredentials = errors.New("no credentials")
+
+type AuthError struct {
+	Message string
+}
+
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+type APIKeyAuthenticator struct {
+	db         *database.DB
+	header     string
+	queryParam string
+}
+
+func NewAPIKeyHeaderAuthenticator(db *database.DB, header string) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{db: db, header: header}
+}
+
+func NewAPIKeyQueryAuthenticator(db *database.DB, queryParam string) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{db: db, queryParam: queryParam}
+}
+
+func (a *APIKeyAuthenticator) Authenticate(r *http.Request) (*models.Principal, error) {
+	var apiKey string
+	if a.header != "" {
+		apiKey = r.Header.Get(a.header)
+	} else {
+		apiKey = r.URL.Query().Get(a.queryParam)
+	}
+	if apiKey == "" {
+		return nil, ErrNoCredentials
+	}
+
+	key, err := a.db.GetAPIKeyByKey(apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil {
+		return nil, &AuthError{Message: "Invalid API key"}
+	}
+
+	if !key.IsActive {
+		return nil, &AuthError{Message: "API key inactive"}
+	}
+
+	return principalFromAPIKey(key), nil
+}
+
+type JWTAuthenticator struct {
+	validator *services.JWTValidator
+}
+
+func NewJWTAuthenticator(validator *services.JWTValidator) *JWTAuthenticator {
+	return &JWTAuthenticator{validator: validator}
+}
+
+func (a *JWTAuthenticator) Authenticate(r *http.Request) (*models.Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+
+	// Tokens from another issuer may still be accepted by a later
+	// authenticator, such as oauth2 introspection.
+	claims, err := a.validator.Validate(r.Context(), token)
+	if errors.Is(err, services.ErrUnknownToken) {
+		return nil, ErrNoCredentials
+	}
+	if err != nil {
+		log.Printf("JWT rejected: %v", err)
+		return nil, &AuthError{Message: "Invalid token"}
+	}
+
+	principal, err := a.validator.Principal(claims)
+	if err != nil {
+		log.Printf("JWT rejected: %v", err)
+		return nil, &AuthError{Message: "Invalid token"}
+	}
+
+	return principal, nil
+}
+
+type ClientCertAuthenticator struct {
+	limits        config.RateLimitConfig
+	principalFrom string
+}
+
+func NewClientCertAuthenticator(limits config.RateLimitConfig, principalFrom string) (*ClientCertAuthenticator, error) {
+	switch principalFrom {
+	case "":
+		principalFrom = "cn"
+	case "cn", "dns", "uri", "email":
+	default:
+		return nil, fmt.Errorf("unknown client certificate principal field %q", principalFrom)
+	}
+	return &ClientCertAuthenticator{limits: limits, principalFrom: principalFrom}, nil
+}
+
+func (a *ClientCertAuthenticator) Authenticate(r *http.Request) (*models.Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	id := certificateIdentity(cert, a.principalFrom)
+	if id == "" {
+		return nil, &AuthError{Message: "Client certificate has no " + a.principalFrom + " identity"}
+	}
+
+	name := cert.Subject.CommonName
+	if name == "" {
+		name = id
+	}
+	var tenant string
+	if len(cert.Subject.Organization) > 0 {
+		tenant = cert.Subject.Organization[0]
+	}
+
+	return &models.Principal{
+		ID:                 id,
+		Type:               "mtls",
+		Name:               name,
+		Tenant:             tenant,
+		RateLimitPerMinute: a.limits.RateLimitPerMinute,
+		RateLimitPerHour:   a.limits.RateLimitPerHour,
+	}, nil
+}
+
+func certificateIdentity(cert *x509.Certificate, field string) string {
+	switch field {
+	case "dns":
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case "uri":
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String()
+		}
+	case "email":
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	default:
+		return cert.Subject.CommonName
+	}
+	return ""
+}
+
+type AnonymousAuthenticator struct {
+	limits config.RateLimitConfig
+}
+
+func NewAnonymousAuthenticator(limits config.RateLimitConfig) *AnonymousAuthenticator {
+	return &AnonymousAuthenticator{limits: limits}
+}
+
+func (a *AnonymousAuthenticator) Authenticate(r *http.Request) (*models.Principal, error) {
+	ip := ClientIP(r)
+	return &models.Principal{
+		ID:                 ip,
+		Type:               "anonymous",
+		Name:               fmt.Sprintf("anonymous (%s)", ip),
+		RateLimitPerMinute: a.limits.RateLimitPerMinute,
+		RateLimitPerHour:   a.limits.RateLimitPerHour,
+	}, nil
+}
+
+type IntrospectionAuthenticator struct {
+	introspector *services.TokenIntrospector
+}
+
+func NewIntrospectionAuthenticator(introspector *services.TokenIntrospector) *IntrospectionAuthenticator {
+	return &IntrospectionAuthenticator{introspector: introspector}
+}
+
+func (a *IntrospectionAuthenticator) Authenticate(r *http.Request) (*models.Principal, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+
+	result, err := a.introspector.Introspect(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Active {
+		return nil, &AuthError{Message: "Invalid token"}
+	}
+
+	principal, err := a.introspector.Principal(result)
+	if err != nil {
+		log.Printf("Introspected token rejected: %v", err)
+		return nil, &AuthError{Message: "Invalid token"}
+	}
+
+	return principal, nil
+}
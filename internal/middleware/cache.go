@@ -1,9 +1,15 @@
 package middleware
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"io"
+	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"api-gateway/internal/services"
@@ -12,44 +18,88 @@ import (
 type CacheMiddleware struct {
 	cacheService     *services.CacheService
 	cacheTTL         time.Duration
+	maxBodyBytes     int
+	compressor       *services.Compressor
 	metricsCollector *services.MetricsCollector
 }
 
-func NewCacheMiddleware(cacheService *services.CacheService, cacheTTL time.Duration, metricsCollector *services.MetricsCollector) *CacheMiddleware {
+func NewCacheMiddleware(cacheService *services.CacheService, cacheTTL time.Duration, maxBodyBytes int, compressor *services.Compressor, metricsCollector *services.MetricsCollector) *CacheMiddleware {
 	return &CacheMiddleware{
 		cacheService:     cacheService,
 		cacheTTL:         cacheTTL,
+		maxBodyBytes:     maxBodyBytes,
+		compressor:       compressor,
 		metricsCollector: metricsCollector,
 	}
 }
 
 type responseWriter struct {
 	http.ResponseWriter
-	statusCode int
-	body       *bytes.Buffer
+	statusCode   int
+	header       http.Header
+	body         *bytes.Buffer
+	maxBodyBytes int
+	wroteHeader  bool
+	bypass       bool
 }
 
-func newResponseWriter(w http.ResponseWriter) *responseWriter {
+func newResponseWriter(w http.ResponseWriter, maxBodyBytes int) *responseWriter {
 	return &responseWriter{
 		ResponseWriter: w,
 		statusCode:     http.StatusOK,
 		body:           &bytes.Buffer{},
+		maxBodyBytes:   maxBodyBytes,
 	}
 }
 
 func (rw *responseWriter) WriteHeader(statusCode int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.wroteHeader = true
 	rw.statusCode = statusCode
+	rw.header = rw.Header().Clone()
+	if services.IsStreamingResponse(rw.Header()) {
+		rw.stopBuffering()
+	}
 	rw.ResponseWriter.WriteHeader(statusCode)
 }
 
 func (rw *responseWriter) Write(b []byte) (int, error) {
-	rw.body.Write(b)
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if !rw.bypass {
+		if rw.body.Len()+len(b) > rw.maxBodyBytes {
+			rw.stopBuffering()
+		} else {
+			rw.body.Write(b)
+		}
+	}
 	return rw.ResponseWriter.Write(b)
 }
 
+func (rw *responseWriter) Flush() {
+	http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rw.stopBuffering()
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *responseWriter) stopBuffering() {
+	rw.bypass = true
+	rw.body = &bytes.Buffer{}
+}
+
 func (m *CacheMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		if r.Method != http.MethodGet || strings.Contains(r.Header.Get("Accept"), "text/event-stream") || services.IsWebSocketUpgrade(r) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -64,27 +114,73 @@ func (m *CacheMiddleware) Middleware(next http.Handler) http.Handler {
 		}
 
 		if cached != nil {
-			m.metricsCollector.RecordCacheHit()
-			w.Header().Set("X-Cache", "HIT")
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(cached.StatusCode)
-			w.Write(cached.Body)
-			return
+			body, encoding, err := m.negotiateCached(cached, r.Header.Get("Accept-Encoding"))
+			if err != nil {
+				log.Printf("Dropping unreadable cache entry: %v", err)
+				m.cacheService.Delete(ctx, cacheKey)
+			} else {
+				m.metricsCollector.RecordCacheHit()
+				contentType := cached.ContentType
+				if contentType == "" {
+					contentType = "application/json"
+				}
+				w.Header().Set("X-Cache", "HIT")
+				w.Header().Set("Content-Type", contentType)
+				if encoding != "" {
+					w.Header().Set("Content-Encoding", encoding)
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				w.WriteHeader(cached.StatusCode)
+				w.Write(body)
+				return
+			}
 		}
 
 		m.metricsCollector.RecordCacheMiss()
 		w.Header().Set("X-Cache", "MISS")
 
-		rw := newResponseWriter(w)
+		rw := newResponseWriter(w, m.maxBodyBytes)
 		next.ServeHTTP(rw, r)
 
-		if rw.statusCode == http.StatusOK && rw.body.Len() > 0 {
+		if rw.statusCode == http.StatusOK && !rw.bypass && rw.body.Len() > 0 {
 			cachedResp := &services.CachedResponse{
-				StatusCode: rw.statusCode,
-				Body:       rw.body.Bytes(),
+				StatusCode:      rw.statusCode,
+				Body:            rw.body.Bytes(),
+				ContentType:     rw.header.Get("Content-Type"),
+				ContentEncoding: rw.header.Get("Content-Encoding"),
+			}
+
+			if encoding := m.compressor.StorageEncoding(); encoding != "" && m.compressor.ShouldCompress(rw.header, rw.statusCode) {
+				compressed, err := m.compressor.Compress(encoding, cachedResp.Body)
+				if err != nil {
+					log.Printf("Cache compression failed: %v", err)
+					return
+				}
+				cachedResp.Body = compressed
+				cachedResp.ContentEncoding = encoding
 			}
 
 			m.cacheService.Set(ctx, cacheKey, cachedResp, m.cacheTTL)
 		}
 	})
 }
+
+// negotiateCached returns the cached body as stored when the client accepts
+// its encoding, and decompressed otherwise.
+func (m *CacheMiddleware) negotiateCached(cached *services.CachedResponse, acceptEncoding string) ([]byte, string, error) {
+	if cached.ContentEncoding == "" || services.AcceptsEncoding(acceptEncoding, cached.ContentEncoding) {
+		return cached.Body, cached.ContentEncoding, nil
+	}
+
+	decoder, err := services.NewDecoder(cached.ContentEncoding, bytes.NewReader(cached.Body))
+	if err != nil {
+		return nil, "", err
+	}
+	defer decoder.Close()
+
+	body, err := io.ReadAll(decoder)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, "", nil
+}
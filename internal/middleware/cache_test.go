@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/services"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestCache(t *testing.T) (*CacheMiddleware, *services.CacheService, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	compressor, err := services.NewCompressor(config.CompressionConfig{Enabled: true, Encodings: []string{"br", "gzip"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheService := services.NewCacheService(client, time.Minute)
+	return NewCacheMiddleware(cacheService, time.Minute, 1<<20, compressor, services.NewMetricsCollector()), cacheService, mr
+}
+
+func serveCached(handler http.Handler, acceptEncoding string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/users?page=1", nil)
+	if acceptEncoding != "" {
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestCacheStoresCompressedAndNegotiatesOnHit(t *testing.T) {
+	m, cacheService, mr := newTestCache(t)
+
+	body := strings.Repeat(`{"id":1,"name":"gateway"}`, 100)
+	calls := 0
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+
+	miss := serveCached(handler, "")
+	if miss.Header().Get("X-Cache") != "MISS" || miss.Body.String() != body {
+		t.Fatalf("first request should be a plain miss, got %q", miss.Header().Get("X-Cache"))
+	}
+
+	key := cacheService.GenerateCacheKey(http.MethodGet, "/users", "page=1")
+	if got := mr.HGet(key, "content_encoding"); got != services.EncodingBrotli {
+		t.Fatalf("stored content_encoding = %q, want br", got)
+	}
+	if stored := mr.HGet(key, "body"); len(stored) >= len(body) {
+		t.Fatalf("stored body is %d bytes, expected it compressed from %d", len(stored), len(body))
+	}
+
+	tests := []struct {
+		accept       string
+		wantEncoding string
+	}{
+		{accept: "br", wantEncoding: "br"},
+		{accept: "gzip, br", wantEncoding: "br"},
+		{accept: "*", wantEncoding: "br"},
+		{accept: "", wantEncoding: ""},
+		{accept: "gzip", wantEncoding: ""},
+		{accept: "br;q=0, gzip", wantEncoding: ""},
+		{accept: "*, br;q=0", wantEncoding: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			w := serveCached(handler, tt.accept)
+			if w.Header().Get("X-Cache") != "HIT" {
+				t.Fatalf("X-Cache = %q, want HIT", w.Header().Get("X-Cache"))
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/json" {
+				t.Fatalf("Content-Type = %q", got)
+			}
+
+			got := w.Body.Bytes()
+			if w.Header().Get("Content-Length") != strconv.Itoa(len(got)) {
+				t.Fatalf("Content-Length = %s for a %d byte body", w.Header().Get("Content-Length"), len(got))
+			}
+			if tt.wantEncoding != "" {
+				decoder, err := services.NewDecoder(tt.wantEncoding, bytes.NewReader(got))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer decoder.Close()
+				if got, err = io.ReadAll(decoder); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if string(got) != body {
+				t.Fatal("hit returned a different body")
+			}
+		})
+	}
+
+	if calls != 1 {
+		t.Fatalf("upstream called %d times, want 1", calls)
+	}
+}
+
+func TestCacheStoresIncompressibleTypesAsIs(t *testing.T) {
+	m, cacheService, mr := newTestCache(t)
+
+	body := strings.Repeat("\x89PNG", 500)
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		io.WriteString(w, body)
+	}))
+
+	serveCached(handler, "br")
+
+	key := cacheService.GenerateCacheKey(http.MethodGet, "/users", "page=1")
+	if got := mr.HGet(key, "content_encoding"); got != "" {
+		t.Fatalf("stored content_encoding = %q, want none", got)
+	}
+
+	w := serveCached(handler, "br")
+	if w.Header().Get("X-Cache") != "HIT" || w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+		t.Fatal("expected an uncompressed hit")
+	}
+	if got := w.Header().Get("Content-Type"); got != "image/png" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+}
+
+func TestCacheReplacesLegacyStringEntries(t *testing.T) {
+	m, cacheService, mr := newTestCache(t)
+
+	key := cacheService.GenerateCacheKey(http.MethodGet, "/users", "page=1")
+	if err := mr.Set(key, `{"legacy":true}`); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"fresh":true}`)
+	}))
+
+	w := serveCached(handler, "")
+	if w.Header().Get("X-Cache") != "MISS" || w.Body.String() != `{"fresh":true}` {
+		t.Fatalf("legacy entry should be a miss, got %q %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+	if mr.Type(key) != "hash" {
+		t.Fatalf("legacy entry was not replaced, key type is %q", mr.Type(key))
+	}
+
+	w = serveCached(handler, "")
+	if w.Header().Get("X-Cache") != "HIT" || w.Body.String() != `{"fresh":true}` {
+		t.Fatalf("expected a hit on the new entry, got %q %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+}
+
+func TestCacheDropsUnreadableEntries(t *testing.T) {
+	m, cacheService, mr := newTestCache(t)
+
+	key := cacheService.GenerateCacheKey(http.MethodGet, "/users", "page=1")
+	mr.HSet(key, "status", "200", "body", "not brotli", "content_type", "application/json", "content_encoding", "br")
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"fresh":true}`)
+	}))
+
+	w := serveCached(handler, "identity")
+	if w.Header().Get("X-Cache") != "MISS" || w.Body.String() != `{"fresh":true}` {
+		t.Fatalf("unreadable entry should be a miss, got %q %q", w.Header().Get("X-Cache"), w.Body.String())
+	}
+}
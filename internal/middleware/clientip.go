@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"api-gateway/internal/services"
+)
+
+// ClientIPMiddleware works out the caller's address. Forwarding headers are
+// only believed when the connection comes from a trusted proxy, since anyone
+// else can put whatever they like in them.
+type ClientIPMiddleware struct {
+	trustedProxies []*net.IPNet
+}
+
+func NewClientIPMiddleware(trustedProxies []string) (*ClientIPMiddleware, error) {
+	m := &ClientIPMiddleware{}
+	for _, value := range trustedProxies {
+		cidr := value
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", value)
+		}
+		m.trustedProxies = append(m.trustedProxies, network)
+	}
+	return m, nil
+}
+
+func (m *ClientIPMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := services.WithClientIP(r.Context(), m.resolve(r), m.trusted(services.RemoteIP(r)))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (m *ClientIPMiddleware) resolve(r *http.Request) string {
+	ip := services.RemoteIP(r)
+	if !m.trusted(ip) {
+		return ip
+	}
+
+	// Walk X-Forwarded-For from the right, skipping our own proxies. The
+	// first address we don't trust is the client.
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	if len(hops) > 0 {
+		for i := len(hops) - 1; i >= 0; i-- {
+			if net.ParseIP(hops[i]) == nil {
+				return ip
+			}
+			ip = hops[i]
+			if !m.trusted(ip) {
+				return ip
+			}
+		}
+		return ip
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return ip
+}
+
+func (m *ClientIPMiddleware) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range m.trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address resolved by ClientIPMiddleware, or the
+// connection's address if the middleware didn't run.
+func ClientIP(r *http.Request) string {
+	return services.ClientIP(r)
+}
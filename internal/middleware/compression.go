@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"strings"
+
+	"api-gateway/internal/services"
+)
+
+type CompressionMiddleware struct {
+	compressor *services.Compressor
+}
+
+func NewCompressionMiddleware(compressor *services.Compressor) *CompressionMiddleware {
+	return &CompressionMiddleware{
+		compressor: compressor,
+	}
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	compressor  *services.Compressor
+	encoding    string
+	encoder     services.EncodeWriter
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(statusCode int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	header := cw.Header()
+	if cw.compressor.ShouldCompress(header, statusCode) {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		cw.encoder = cw.compressor.NewWriter(cw.encoding, cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.encoder != nil {
+		cw.encoder.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(cw.ResponseWriter).Hijack()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) Close() {
+	if cw.encoder != nil {
+		cw.encoder.Close()
+		cw.encoder = nil
+	}
+}
+
+func (m *CompressionMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.compressor.Enabled() || r.Method == http.MethodHead || services.IsWebSocketUpgrade(r) || services.IsGRPCRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := m.compressor.Negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, compressor: m.compressor, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
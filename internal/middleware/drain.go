@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+type DrainMiddleware struct {
+	draining atomic.Bool
+	inFlight atomic.Int64
+}
+
+func NewDrainMiddleware() *DrainMiddleware {
+	return &DrainMiddleware{}
+}
+
+func (m *DrainMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+
+		if m.draining.Load() {
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Drain marks the gateway as shutting down. Requests are still served, but
+// connections are closed after each response so clients move elsewhere.
+func (m *DrainMiddleware) Drain() {
+	m.draining.Store(true)
+}
+
+func (m *DrainMiddleware) Draining() bool {
+	return m.draining.Load()
+}
+
+func (m *DrainMiddleware) InFlight() int64 {
+	return m.inFlight.Load()
+}
+
+// Wait blocks until no requests are in flight or ctx is done. It also covers
+// h2c streams and WebSockets, which http.Server.Shutdown doesn't track.
+func (m *DrainMiddleware) Wait(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for m.inFlight.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
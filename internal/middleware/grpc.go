@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"api-gateway/internal/services"
+)
+
+type GRPCMiddleware struct {
+	metricsCollector *services.MetricsCollector
+}
+
+func NewGRPCMiddleware(metricsCollector *services.MetricsCollector) *GRPCMiddleware {
+	return &GRPCMiddleware{metricsCollector: metricsCollector}
+}
+
+type grpcResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	errorBody   bytes.Buffer
+}
+
+func (gw *grpcResponseWriter) WriteHeader(statusCode int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+	gw.statusCode = statusCode
+	if statusCode < http.StatusBadRequest {
+		gw.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+func (gw *grpcResponseWriter) Write(b []byte) (int, error) {
+	if !gw.wroteHeader {
+		gw.WriteHeader(http.StatusOK)
+	}
+	if gw.statusCode >= http.StatusBadRequest {
+		return gw.errorBody.Write(b)
+	}
+	return gw.ResponseWriter.Write(b)
+}
+
+func (gw *grpcResponseWriter) Flush() {
+	if gw.statusCode < http.StatusBadRequest {
+		http.NewResponseController(gw.ResponseWriter).Flush()
+	}
+}
+
+func (gw *grpcResponseWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// writeError turns a gateway or upstream HTTP error into a trailers-only gRPC
+// response, which is the only error shape gRPC clients understand.
+func (gw *grpcResponseWriter) writeError() {
+	message := http.StatusText(gw.statusCode)
+	var body struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(gw.errorBody.Bytes(), &body) == nil && body.Error != "" {
+		message = body.Error
+	}
+
+	header := gw.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Type", "application/grpc")
+	header.Set("Grpc-Status", strconv.Itoa(services.GRPCCodeForHTTPStatus(gw.statusCode)))
+	header.Set("Grpc-Message", services.EncodeGRPCMessage(message))
+	gw.ResponseWriter.WriteHeader(http.StatusOK)
+}
+
+func (m *GRPCMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !services.IsGRPCRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &grpcResponseWriter{ResponseWriter: w}
+		next.ServeHTTP(gw, r)
+
+		if gw.statusCode >= http.StatusBadRequest {
+			gw.writeError()
+		}
+
+		if status := services.GRPCStatus(w.Header()); status != "" {
+			m.metricsCollector.RecordGRPCStatus(services.GRPCCodeName(status))
+		}
+	})
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"api-gateway/internal/database"
+	"api-gateway/internal/models"
+	"api-gateway/internal/services"
+
+	"github.com/google/uuid"
+)
+
+type HMACAuthenticator struct {
+	db           *database.DB
+	nonces       *services.NonceStore
+	maxSkew      time.Duration
+	maxBodyBytes int64
+}
+
+func NewHMACAuthenticator(db *database.DB, nonces *services.NonceStore, maxSkew time.Duration, maxBodyBytes int64) *HMACAuthenticator {
+	return &HMACAuthenticator{
+		db:           db,
+		nonces:       nonces,
+		maxSkew:      maxSkew,
+		maxBodyBytes: maxBodyBytes,
+	}
+}
+
+func (a *HMACAuthenticator) Authenticate(r *http.Request) (*models.Principal, error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, services.SignatureAlgorithm+" ") {
+		return nil, ErrNoCredentials
+	}
+
+	params, err := services.ParseSignatureHeader(header)
+	if err != nil {
+		return nil, &AuthError{Message: "Malformed signature: " + err.Error()}
+	}
+
+	if !containsHeader(params.SignedHeaders, "host") || !containsHeader(params.SignedHeaders, strings.ToLower(services.SignatureDateHeader)) {
+		return nil, &AuthError{Message: "Signature must cover host and " + services.SignatureDateHeader}
+	}
+
+	timestamp := r.Header.Get(services.SignatureDateHeader)
+	signedAt, err := time.Parse(services.SignatureDateFormat, timestamp)
+	if err != nil {
+		return nil, &AuthError{Message: "Invalid " + services.SignatureDateHeader}
+	}
+	if skew := time.Since(signedAt); skew > a.maxSkew || skew < -a.maxSkew {
+		return nil, &AuthError{Message: "Request timestamp outside allowed window"}
+	}
+
+	nonce := r.Header.Get(services.SignatureNonceHeader)
+	if nonce == "" {
+		return nil, &AuthError{Message: "Missing " + services.SignatureNonceHeader}
+	}
+
+	payloadHash, err := a.payloadHash(r)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := uuid.Parse(params.Credential)
+	if err != nil {
+		return nil, &AuthError{Message: "Invalid credential"}
+	}
+
+	key, err := a.db.GetAPIKeyByID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || key.SigningSecret == "" {
+		return nil, &AuthError{Message: "Invalid credential"}
+	}
+
+	canonical := services.CanonicalRequest(r, params.SignedHeaders, payloadHash)
+	expected := services.ComputeSignature(key.SigningSecret, services.StringToSign(timestamp, nonce, canonical))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(params.Signature))) {
+		return nil, &AuthError{Message: "Signature mismatch"}
+	}
+
+	fresh, err := a.nonces.Claim(r.Context(), params.Credential, nonce, 2*a.maxSkew)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, &AuthError{Message: "Replayed request"}
+	}
+
+	return principalFromAPIKey(key), nil
+}
+
+func (a *HMACAuthenticator) payloadHash(r *http.Request) (string, error) {
+	claimed := r.Header.Get(services.SignatureBodyHeader)
+	if claimed == "" {
+		return "", &AuthError{Message: "Missing " + services.SignatureBodyHeader}
+	}
+	if claimed == services.UnsignedPayload {
+		if route := GetRouteFromContext(r.Context()); route == nil || !route.AllowUnsignedPayload {
+			return "", &AuthError{Message: services.UnsignedPayload + " is not allowed on this route"}
+		}
+		return claimed, nil
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return hashBody(nil, claimed)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, a.maxBodyBytes+1))
+	r.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("couldn't read body: %w", err)
+	}
+	if int64(len(body)) > a.maxBodyBytes {
+		return "", &AuthError{Message: "Body too large to verify"}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	return hashBody(body, claimed)
+}
+
+func hashBody(body []byte, claimed string) (string, error) {
+	sum := sha256.Sum256(body)
+	actual := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(actual, claimed) {
+		return "", &AuthError{Message: "Body hash mismatch"}
+	}
+	return actual, nil
+}
+
+func containsHeader(headers []string, name string) bool {
+	for _, h := range headers {
+		if h == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/services"
+)
+
+type LimitsMiddleware struct {
+	maxBodyBytes int64
+}
+
+func NewLimitsMiddleware(maxBodyBytes int64) *LimitsMiddleware {
+	return &LimitsMiddleware{
+		maxBodyBytes: maxBodyBytes,
+	}
+}
+
+// Middleware enforces the route's URL, header and body limits, or the global
+// body limit. It runs before auth, so nothing, HMAC verification included,
+// reads more of a body than the route allows.
+func (m *LimitsMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := GetRouteFromContext(r.Context())
+		if route != nil && route.Limits != nil {
+			if route.Limits.MaxURLLength > 0 && len(r.RequestURI) > route.Limits.MaxURLLength {
+				log.Printf("URL too long for route %s: %d bytes", route.Name, len(r.RequestURI))
+				http.Error(w, `{"error":"URI too long"}`, http.StatusRequestURITooLong)
+				return
+			}
+			if route.Limits.MaxHeaderBytes > 0 && headerBytes(r.Header) > route.Limits.MaxHeaderBytes {
+				log.Printf("Headers too large for route %s: %d bytes", route.Name, headerBytes(r.Header))
+				http.Error(w, `{"error":"Request headers too large"}`, http.StatusRequestHeaderFieldsTooLarge)
+				return
+			}
+		}
+
+		if limitBody(w, r, m.bodyLimit(route)) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// KeyMiddleware runs after auth and applies the caller's own body limit,
+// which can only lower the route's.
+func (m *LimitsMiddleware) KeyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := GetPrincipalFromContext(r.Context())
+		if principal == nil || principal.MaxBodyBytes <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limit := m.bodyLimit(GetRouteFromContext(r.Context()))
+		if limit > 0 && principal.MaxBodyBytes >= limit {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if limitBody(w, r, principal.MaxBodyBytes) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func (m *LimitsMiddleware) bodyLimit(route *config.RouteConfig) int64 {
+	if route != nil && route.Limits != nil && route.Limits.MaxBodyBytes > 0 {
+		return route.Limits.MaxBodyBytes
+	}
+	return m.maxBodyBytes
+}
+
+// limitBody caps r.Body at limit, and rejects the request if its
+// Content-Length is already over. gRPC streams can carry any number of
+// messages, so they aren't capped as a whole.
+func limitBody(w http.ResponseWriter, r *http.Request, limit int64) bool {
+	if limit <= 0 || r.Body == nil || r.Body == http.NoBody || services.IsGRPCRequest(r) {
+		return true
+	}
+	if r.ContentLength > limit {
+		log.Printf("Request body too large: %d bytes, limit %d", r.ContentLength, limit)
+		http.Error(w, `{"error":"Request body too large"}`, http.StatusRequestEntityTooLarge)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return true
+}
+
+func headerBytes(header http.Header) int {
+	size := 0
+	for key, values := range header {
+		for _, value := range values {
+			size += len(key) + len(value) + 4
+		}
+	}
+	return size
+}
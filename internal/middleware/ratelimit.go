@@ -22,17 +22,17 @@ func NewRateLimitMiddleware(rateLimiter *services.RateLimiter, metricsCollector
 
 func (m *RateLimitMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		apiKey := GetAPIKeyFromContext(r.Context())
-		if apiKey == nil {
+		principal := GetPrincipalFromContext(r.Context())
+		if principal == nil {
 			next.ServeHTTP(w, r)
 			return
 		}
 
 		allowed, remainingMinute, remainingHour, err := m.rateLimiter.AllowRequest(
 			r.Context(),
-			apiKey.Key,
-			apiKey.RateLimitPerMinute,
-			apiKey.RateLimitPerHour,
+			principal.Type+":"+principal.ID,
+			principal.RateLimitPerMinute,
+			principal.RateLimitPerHour,
 		)
 
 		if err != nil {
@@ -41,13 +41,13 @@ func (m *RateLimitMiddleware) Middleware(next http.Handler) http.Handler {
 			return
 		}
 
-		w.Header().Set("X-RateLimit-Limit-Minute", fmt.Sprintf("%d", apiKey.RateLimitPerMinute))
-		w.Header().Set("X-RateLimit-Limit-Hour", fmt.Sprintf("%d", apiKey.RateLimitPerHour))
+		w.Header().Set("X-RateLimit-Limit-Minute", fmt.Sprintf("%d", principal.RateLimitPerMinute))
+		w.Header().Set("X-RateLimit-Limit-Hour", fmt.Sprintf("%d", principal.RateLimitPerHour))
 		w.Header().Set("X-RateLimit-Remaining-Minute", fmt.Sprintf("%d", remainingMinute))
 		w.Header().Set("X-RateLimit-Remaining-Hour", fmt.Sprintf("%d", remainingHour))
 
 		if !allowed {
-			log.Printf("Rate limited: %s", apiKey.Name)
+			log.Printf("Rate limited: %s", principal.Name)
 			m.metricsCollector.RecordRateLimitHit()
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusTooManyRequests)
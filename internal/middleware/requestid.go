@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+
+	"api-gateway/internal/services"
+
+	"github.com/google/uuid"
+)
+
+const maxRequestIDLength = 128
+
+type RequestIDMiddleware struct{}
+
+func NewRequestIDMiddleware() *RequestIDMiddleware {
+	return &RequestIDMiddleware{}
+}
+
+func (m *RequestIDMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(services.RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+			r.Header.Set(services.RequestIDHeader, requestID)
+		}
+
+		w.Header().Set(services.RequestIDHeader, requestID)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/services"
+)
+
+const RouteContextKey contextKey = "route"
+
+type RouteMiddleware struct {
+	router *services.Router
+}
+
+func NewRouteMiddleware(router *services.Router) *RouteMiddleware {
+	return &RouteMiddleware{router: router}
+}
+
+func (m *RouteMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := m.router.Match(r)
+		if route == nil {
+			http.Error(w, `{"error":"No route"}`, http.StatusNotFound)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), RouteContextKey, route)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func GetRouteFromContext(ctx context.Context) *config.RouteConfig {
+	if route, ok := ctx.Value(RouteContextKey).(*config.RouteConfig); ok {
+		return route
+	}
+	return nil
+}
@@ -10,8 +10,10 @@ type APIKey struct {
 	ID                 uuid.UUID `json:"id"`
 	Key                string    `json:"key"`
 	Name               string    `json:"name"`
+	SigningSecret      string    `json:"signing_secret,omitempty"`
 	RateLimitPerMinute int       `json:"rate_limit_per_minute"`
 	RateLimitPerHour   int       `json:"rate_limit_per_hour"`
+	MaxBodyBytes       int64     `json:"max_body_bytes,omitempty"`
 	IsActive           bool      `json:"is_active"`
 	CreatedAt          time.Time `json:"created_at"`
 }
@@ -37,3 +39,16 @@ type BackendRoute struct {
 	IsActive        bool      `json:"is_active"`
 	CreatedAt       time.Time `json:"created_at"`
 }
+
+type Principal struct {
+	ID                 string     `json:"id"`
+	Type               string     `json:"type"`
+	AuthMethod         string     `json:"auth_method"`
+	Name               string     `json:"name"`
+	APIKeyID           *uuid.UUID `json:"api_key_id,omitempty"`
+	Tenant             string     `json:"tenant,omitempty"`
+	Scopes             []string   `json:"scopes,omitempty"`
+	RateLimitPerMinute int        `json:"rate_limit_per_minute"`
+	RateLimitPerHour   int        `json:"rate_limit_per_hour"`
+	MaxBodyBytes       int64      `json:"max_body_bytes,omitempty"`
+}
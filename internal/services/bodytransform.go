@@ -0,0 +1,383 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"api-gateway/internal/config"
+)
+
+const defaultTransformMaxBodyBytes = 10 << 20
+
+type BodyTransform struct {
+	unwrapPath   string
+	unwrap       []pathStep
+	project      map[string][]pathStep
+	allow        [][]string
+	deny         [][]string
+	renames      []fieldRename
+	wrap         string
+	maxBodyBytes int64
+}
+
+type fieldRename struct {
+	from []string
+	to   string
+}
+
+// pathStep is one step of a projection path such as data.items[*].id.
+type pathStep struct {
+	key      string
+	index    int
+	indexed  bool
+	wildcard bool
+}
+
+func NewBodyTransform(cfg *config.BodyTransformConfig) (*BodyTransform, error) {
+	bt := &BodyTransform{
+		unwrapPath:   cfg.Unwrap,
+		project:      make(map[string][]pathStep),
+		wrap:         cfg.Wrap,
+		maxBodyBytes: cfg.MaxBodyBytes,
+	}
+	if bt.maxBodyBytes <= 0 {
+		bt.maxBodyBytes = defaultTransformMaxBodyBytes
+	}
+
+	var err error
+	if cfg.Unwrap != "" {
+		if bt.unwrap, err = parseJSONPath(cfg.Unwrap); err != nil {
+			return nil, err
+		}
+	}
+	for key, path := range cfg.Project {
+		if bt.project[key], err = parseJSONPath(path); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range cfg.Allow {
+		bt.allow = append(bt.allow, strings.Split(path, "."))
+	}
+	for _, path := range cfg.Deny {
+		bt.deny = append(bt.deny, strings.Split(path, "."))
+	}
+	// Renames run sorted by source path so overlapping ones like a→b and b→c
+	// always give the same result.
+	sources := make([]string, 0, len(cfg.Rename))
+	for from := range cfg.Rename {
+		sources = append(sources, from)
+	}
+	sort.Strings(sources)
+	targets := make(map[string]string)
+	for _, from := range sources {
+		to := cfg.Rename[from]
+		if strings.Contains(to, ".") {
+			return nil, fmt.Errorf("rename target %q must be a plain field name", to)
+		}
+		keys := strings.Split(from, ".")
+		target := strings.Join(append(keys[:len(keys)-1:len(keys)-1], to), ".")
+		if other, ok := targets[target]; ok {
+			return nil, fmt.Errorf("rename of %q and %q both target %q", other, from, target)
+		}
+		targets[target] = from
+		bt.renames = append(bt.renames, fieldRename{from: keys, to: to})
+	}
+
+	return bt, nil
+}
+
+func parseJSONPath(path string) ([]pathStep, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+
+	var steps []pathStep
+	for path != "" {
+		switch {
+		case path[0] == '[':
+			end := strings.IndexByte(path, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: unclosed [", path)
+			}
+			inner := path[1:end]
+			if inner == "*" {
+				steps = append(steps, pathStep{wildcard: true})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid path index %q", inner)
+				}
+				steps = append(steps, pathStep{index: index, indexed: true})
+			}
+			path = path[end+1:]
+		case path[0] == '.':
+			path = path[1:]
+		default:
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			if path[:end] == "*" {
+				steps = append(steps, pathStep{wildcard: true})
+			} else {
+				steps = append(steps, pathStep{key: path[:end]})
+			}
+			path = path[end:]
+		}
+	}
+	return steps, nil
+}
+
+func (bt *BodyTransform) Apply(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return nil, err
+	}
+
+	if bt.unwrap != nil {
+		unwrapped, ok := evalJSONPath(body, bt.unwrap)
+		if !ok {
+			log.Printf("Body transform: unwrap path %q not found, passing the body through", bt.unwrapPath)
+			return data, nil
+		}
+		body = unwrapped
+	}
+	if len(bt.project) > 0 {
+		projected := make(map[string]interface{}, len(bt.project))
+		for key, steps := range bt.project {
+			if value, ok := evalJSONPath(body, steps); ok {
+				projected[key] = value
+			}
+		}
+		body = projected
+	}
+	if len(bt.allow) > 0 {
+		body = pickFields(body, bt.allow)
+	}
+	for _, keys := range bt.deny {
+		deleteField(body, keys)
+	}
+	for _, rename := range bt.renames {
+		renameField(body, rename.from, rename.to)
+	}
+	if bt.wrap != "" {
+		body = map[string]interface{}{bt.wrap: body}
+	}
+
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(body); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
+
+func evalJSONPath(value interface{}, steps []pathStep) (interface{}, bool) {
+	if len(steps) == 0 {
+		return value, true
+	}
+	step := steps[0]
+
+	switch {
+	case step.wildcard:
+		var items []interface{}
+		switch v := value.(type) {
+		case []interface{}:
+			items = v
+		case map[string]interface{}:
+			// Sorted by key, so the projected array is the same every time.
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				items = append(items, v[key])
+			}
+		default:
+			return nil, false
+		}
+		results := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			if result, ok := evalJSONPath(item, steps[1:]); ok {
+				results = append(results, result)
+			}
+		}
+		return results, true
+	case step.indexed:
+		list, ok := value.([]interface{})
+		index := step.index
+		if index < 0 {
+			index += len(list)
+		}
+		if !ok || index < 0 || index >= len(list) {
+			return nil, false
+		}
+		return evalJSONPath(list[index], steps[1:])
+	default:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		child, ok := object[step.key]
+		if !ok {
+			return nil, false
+		}
+		return evalJSONPath(child, steps[1:])
+	}
+}
+
+// pickFields keeps only the listed dotted paths. Arrays are walked
+// element by element, so "items.id" keeps the id of every item.
+func pickFields(value interface{}, paths [][]string) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		picked := make([]interface{}, len(v))
+		for i, item := range v {
+			picked[i] = pickFields(item, paths)
+		}
+		return picked
+	case map[string]interface{}:
+		nested := make(map[string][][]string)
+		whole := make(map[string]bool)
+		for _, path := range paths {
+			if len(path) == 1 {
+				whole[path[0]] = true
+			} else {
+				nested[path[0]] = append(nested[path[0]], path[1:])
+			}
+		}
+
+		picked := make(map[string]interface{})
+		for key, child := range v {
+			if whole[key] {
+				picked[key] = child
+			} else if rest, ok := nested[key]; ok {
+				picked[key] = pickFields(child, rest)
+			}
+		}
+		return picked
+	default:
+		return value
+	}
+}
+
+func deleteField(value interface{}, keys []string) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			deleteField(item, keys)
+		}
+	case map[string]interface{}:
+		if len(keys) == 1 {
+			delete(v, keys[0])
+		} else if child, ok := v[keys[0]]; ok {
+			deleteField(child, keys[1:])
+		}
+	}
+}
+
+func renameField(value interface{}, keys []string, to string) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			renameField(item, keys, to)
+		}
+	case map[string]interface{}:
+		if len(keys) > 1 {
+			if child, ok := v[keys[0]]; ok {
+				renameField(child, keys[1:], to)
+			}
+			return
+		}
+		if child, ok := v[keys[0]]; ok {
+			delete(v, keys[0])
+			v[to] = child
+		}
+	}
+}
+
+func isJSONContent(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func (p *ProxyService) bodyTransform(route *config.RouteConfig, response bool) *BodyTransform {
+	if route == nil || route.Body == nil {
+		return nil
+	}
+	if response {
+		return p.bodyTransforms[route.Body.Response]
+	}
+	return p.bodyTransforms[route.Body.Request]
+}
+
+func (p *ProxyService) transformRequest(r *http.Request, route *config.RouteConfig) (*http.Request, error) {
+	transform := p.bodyTransform(route, false)
+	if transform == nil || r.Body == nil || r.Body == http.NoBody || !isJSONContent(r.Header) {
+		return r, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, transform.maxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > transform.maxBodyBytes {
+		return nil, &RequestError{Status: http.StatusRequestEntityTooLarge, Message: "Request body too large"}
+	}
+
+	transformed, err := transform.Apply(data)
+	if err != nil {
+		return nil, &RequestError{Status: http.StatusBadRequest, Message: "Invalid JSON body"}
+	}
+
+	rewritten := r.Clone(r.Context())
+	rewritten.Body = io.NopCloser(bytes.NewReader(transformed))
+	rewritten.ContentLength = int64(len(transformed))
+	rewritten.Header.Set("Content-Length", strconv.Itoa(len(transformed)))
+	return rewritten, nil
+}
+
+func (p *ProxyService) TransformResponse(resp *http.Response, route *config.RouteConfig) {
+	transform := p.bodyTransform(route, true)
+	if transform == nil || resp.StatusCode < 200 || resp.StatusCode >= 300 ||
+		!isJSONContent(resp.Header) || resp.Header.Get("Content-Encoding") != "" {
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, transform.maxBodyBytes+1))
+	if err == nil && int64(len(data)) > transform.maxBodyBytes {
+		err = fmt.Errorf("body larger than %d bytes", transform.maxBodyBytes)
+	}
+	if err == nil {
+		var transformed []byte
+		if transformed, err = transform.Apply(data); err == nil {
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{bytes.NewReader(transformed), resp.Body}
+			resp.ContentLength = int64(len(transformed))
+			resp.Header.Set("Content-Length", strconv.Itoa(len(transformed)))
+			return
+		}
+	}
+
+	log.Printf("Response transform skipped for route %s: %v", route.Name, err)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+}
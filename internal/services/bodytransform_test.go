@@ -0,0 +1,211 @@
+package services
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"api-gateway/internal/config"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []pathStep
+		wantErr bool
+	}{
+		{path: "data", want: []pathStep{{key: "data"}}},
+		{path: "$.data.items", want: []pathStep{{key: "data"}, {key: "items"}}},
+		{path: "items[*].id", want: []pathStep{{key: "items"}, {wildcard: true}, {key: "id"}}},
+		{path: "items.*.id", want: []pathStep{{key: "items"}, {wildcard: true}, {key: "id"}}},
+		{path: "items[-1]", want: []pathStep{{key: "items"}, {index: -1, indexed: true}}},
+		{path: "[0][1]", want: []pathStep{{index: 0, indexed: true}, {index: 1, indexed: true}}},
+		{path: "items[0", wantErr: true},
+		{path: "items[x]", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parseJSONPath(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("step %d: got %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBodyTransformApply(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.BodyTransformConfig
+		in   string
+		want string
+	}{
+		{
+			name: "unwrap",
+			cfg:  config.BodyTransformConfig{Unwrap: "data.user"},
+			in:   `{"data":{"user":{"id":1}}}`,
+			want: `{"id":1}`,
+		},
+		{
+			name: "unwrap missing path passes body through",
+			cfg:  config.BodyTransformConfig{Unwrap: "data.missing", Wrap: "result"},
+			in:   `{"data":{"user":{"id":1}}}`,
+			want: `{"data":{"user":{"id":1}}}`,
+		},
+		{
+			name: "project wildcard",
+			cfg:  config.BodyTransformConfig{Project: map[string]string{"ids": "items[*].id"}},
+			in:   `{"items":[{"id":1},{"id":2},{"name":"x"}]}`,
+			want: `{"ids":[1,2]}`,
+		},
+		{
+			name: "project wildcard over an object is sorted by key",
+			cfg:  config.BodyTransformConfig{Project: map[string]string{"names": "users.*.name"}},
+			in:   `{"users":{"c":{"name":"carol"},"a":{"name":"alice"},"b":{"name":"bob"}}}`,
+			want: `{"names":["alice","bob","carol"]}`,
+		},
+		{
+			name: "project negative index",
+			cfg:  config.BodyTransformConfig{Project: map[string]string{"last": "items[-1].id", "first": "items[0].id"}},
+			in:   `{"items":[{"id":1},{"id":2},{"id":3}]}`,
+			want: `{"first":1,"last":3}`,
+		},
+		{
+			name: "project out of range is dropped",
+			cfg:  config.BodyTransformConfig{Project: map[string]string{"missing": "items[-4]", "count": "count"}},
+			in:   `{"items":[1,2,3],"count":3}`,
+			want: `{"count":3}`,
+		},
+		{
+			name: "allow on arrays",
+			cfg:  config.BodyTransformConfig{Allow: []string{"items.id", "total"}},
+			in:   `{"items":[{"id":1,"secret":"a"},{"id":2,"secret":"b"}],"total":2,"debug":true}`,
+			want: `{"items":[{"id":1},{"id":2}],"total":2}`,
+		},
+		{
+			name: "deny on arrays",
+			cfg:  config.BodyTransformConfig{Deny: []string{"items.secret", "debug"}},
+			in:   `{"items":[{"id":1,"secret":"a"},{"id":2}],"debug":true}`,
+			want: `{"items":[{"id":1},{"id":2}]}`,
+		},
+		{
+			name: "rename nested and in arrays",
+			cfg:  config.BodyTransformConfig{Rename: map[string]string{"user.uid": "id", "items.sku": "code"}},
+			in:   `{"user":{"uid":7},"items":[{"sku":"a"},{"sku":"b"}]}`,
+			want: `{"items":[{"code":"a"},{"code":"b"}],"user":{"id":7}}`,
+		},
+		{
+			name: "chained renames run in source order",
+			cfg:  config.BodyTransformConfig{Rename: map[string]string{"a": "b", "b": "c"}},
+			in:   `{"a":1,"b":2}`,
+			want: `{"c":1}`,
+		},
+		{
+			name: "wrap",
+			cfg:  config.BodyTransformConfig{Wrap: "data"},
+			in:   `[1,2]`,
+			want: `{"data":[1,2]}`,
+		},
+		{
+			name: "numbers and html are kept as sent",
+			cfg:  config.BodyTransformConfig{Allow: []string{"n", "s"}},
+			in:   `{"n":12345678901234567890,"s":"<b>&</b>","x":1}`,
+			want: `{"n":12345678901234567890,"s":"<b>&</b>"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			bt, err := NewBodyTransform(&cfg)
+			if err != nil {
+				t.Fatalf("NewBodyTransform: %v", err)
+			}
+			got, err := bt.Apply([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewBodyTransformRejectsBadRenames(t *testing.T) {
+	tests := []struct {
+		name   string
+		rename map[string]string
+	}{
+		{name: "dotted target", rename: map[string]string{"a": "b.c"}},
+		{name: "duplicate target", rename: map[string]string{"a": "id", "b": "id"}},
+		{name: "duplicate nested target", rename: map[string]string{"user.a": "id", "user.b": "id"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewBodyTransform(&config.BodyTransformConfig{Rename: tt.rename}); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	if _, err := NewBodyTransform(&config.BodyTransformConfig{Rename: map[string]string{"user.a": "id", "account.a": "id"}}); err != nil {
+		t.Fatalf("same name under different parents should be allowed: %v", err)
+	}
+}
+
+func TestBodyTransformInvalidJSON(t *testing.T) {
+	bt, err := NewBodyTransform(&config.BodyTransformConfig{Wrap: "data"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bt.Apply([]byte(`{"broken":`)); err == nil {
+		t.Fatal("expected Apply to fail on invalid JSON")
+	}
+
+	routes := []config.RouteConfig{{
+		Name:       "transform",
+		PathPrefix: "/",
+		Body:       &config.BodyConfig{Response: &config.BodyTransformConfig{Wrap: "data"}},
+	}}
+	p, err := NewProxyService(nil, nil, config.TimeoutConfig{}, NewMetricsCollector())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.LoadRoutes(routes); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"broken":`
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+	p.TransformResponse(resp, &routes[0])
+
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != body {
+		t.Fatalf("got %q, want the original body %q", got, body)
+	}
+}
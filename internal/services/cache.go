@@ -4,6 +4,8 @@ import (
 	"context"
 	"crypto/sha256"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -22,24 +24,37 @@ func NewCacheService(client *redis.Client, defaultTTL time.Duration) *CacheServi
 }
 
 type CachedResponse struct {
-	StatusCode  int               `json:"status_code"`
-	Headers     map[string]string `json:"headers"`
-	Body        []byte            `json:"body"`
-	ContentType string            `json:"content_type"`
+	StatusCode      int               `json:"status_code"`
+	Headers         map[string]string `json:"headers"`
+	Body            []byte            `json:"body"`
+	ContentType     string            `json:"content_type"`
+	ContentEncoding string            `json:"content_encoding,omitempty"`
 }
 
 func (cs *CacheService) Get(ctx context.Context, key string) (*CachedResponse, error) {
-	data, err := cs.client.Get(ctx, key).Bytes()
-	if err == redis.Nil {
+	fields, err := cs.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		// Entries written before bodies were stored as hashes are plain
+		// strings; treat them as misses so the next response replaces them.
+		if strings.HasPrefix(err.Error(), "WRONGTYPE") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cache read failed: %w", err)
+	}
+	if len(fields) == 0 {
 		return nil, nil
 	}
+
+	statusCode, err := strconv.Atoi(fields["status"])
 	if err != nil {
-		return nil, fmt.Errorf("cache read failed: %w", err)
+		statusCode = 200
 	}
 
 	return &CachedResponse{
-		StatusCode: 200,
-		Body:       data,
+		StatusCode:      statusCode,
+		Body:            []byte(fields["body"]),
+		ContentType:     fields["content_type"],
+		ContentEncoding: fields["content_encoding"],
 	}, nil
 }
 
@@ -48,7 +63,17 @@ func (cs *CacheService) Set(ctx context.Context, key string, response *CachedRes
 		ttl = cs.defaultTTL
 	}
 
-	err := cs.client.Set(ctx, key, response.Body, ttl).Err()
+	_, err := cs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key,
+			"status", response.StatusCode,
+			"body", response.Body,
+			"content_type", response.ContentType,
+			"content_encoding", response.ContentEncoding,
+		)
+		pipe.Expire(ctx, key, ttl)
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("cache write failed: %w", err)
 	}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+
+	CircuitModeAuto   = "auto"
+	CircuitModeOpen   = "forced_open"
+	CircuitModeClosed = "forced_closed"
+)
+
+type CircuitBreaker struct {
+	name string
+	cfg  config.CircuitBreakerConfig
+
+	mu             sync.Mutex
+	state          string
+	mode           string
+	openedAt       time.Time
+	windowStart    time.Time
+	requests       int
+	failures       int
+	slowCalls      int
+	halfOpenActive int
+	halfOpenOK     int
+	rejected       int64
+}
+
+type CircuitBreakerStatus struct {
+	State     string  `json:"state"`
+	Mode      string  `json:"mode"`
+	Requests  int     `json:"window_requests"`
+	ErrorRate float64 `json:"window_error_rate"`
+	SlowRate  float64 `json:"window_slow_call_rate"`
+	Rejected  int64   `json:"rejected"`
+}
+
+func NewCircuitBreaker(name string, cfg config.CircuitBreakerConfig) *CircuitBreaker {
+	if cfg.ErrorRateThreshold <= 0 {
+		cfg.ErrorRateThreshold = 0.5
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 20
+	}
+	if cfg.WindowSeconds <= 0 {
+		cfg.WindowSeconds = 30
+	}
+	if cfg.OpenSeconds <= 0 {
+		cfg.OpenSeconds = 30
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 5
+	}
+
+	return &CircuitBreaker{
+		name:        name,
+		cfg:         cfg,
+		state:       CircuitClosed,
+		mode:        CircuitModeAuto,
+		windowStart: time.Now(),
+	}
+}
+
+type CircuitCall struct {
+	cb       *CircuitBreaker
+	halfOpen bool
+	bypass   bool
+}
+
+func (c *CircuitCall) Done(failed bool, latency time.Duration) {
+	if c == nil || c.bypass {
+		return
+	}
+	if c.halfOpen {
+		c.cb.recordHalfOpen(failed, latency)
+	} else {
+		c.cb.recordClosed(failed, latency)
+	}
+}
+
+func (c *CircuitCall) Abandon() {
+	if c == nil || !c.halfOpen {
+		return
+	}
+
+	c.cb.mu.Lock()
+	defer c.cb.mu.Unlock()
+	if c.cb.state == CircuitHalfOpen && c.cb.halfOpenActive > 0 {
+		c.cb.halfOpenActive--
+	}
+}
+
+func (cb *CircuitBreaker) Allow() (*CircuitCall, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.mode {
+	case CircuitModeOpen:
+		cb.rejected++
+		return nil, ErrCircuitOpen
+	case CircuitModeClosed:
+		return &CircuitCall{cb: cb, bypass: true}, nil
+	}
+
+	now := time.Now()
+	if cb.state == CircuitOpen {
+		if now.Sub(cb.openedAt) < time.Duration(cb.cfg.OpenSeconds)*time.Second {
+			cb.rejected++
+			return nil, ErrCircuitOpen
+		}
+		cb.transition(CircuitHalfOpen)
+	}
+
+	if cb.state == CircuitHalfOpen {
+		if cb.halfOpenActive >= cb.cfg.HalfOpenRequests {
+			cb.rejected++
+			return nil, ErrCircuitOpen
+		}
+		cb.halfOpenActive++
+		return &CircuitCall{cb: cb, halfOpen: true}, nil
+	}
+
+	if now.Sub(cb.windowStart) >= time.Duration(cb.cfg.WindowSeconds)*time.Second {
+		cb.resetWindow(now)
+	}
+	return &CircuitCall{cb: cb}, nil
+}
+
+func (cb *CircuitBreaker) recordClosed(failed bool, latency time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state != CircuitClosed {
+		return
+	}
+
+	cb.requests++
+	if failed {
+		cb.failures++
+	}
+	if cb.cfg.SlowCallMs > 0 && latency >= time.Duration(cb.cfg.SlowCallMs)*time.Millisecond {
+		cb.slowCalls++
+	}
+
+	if cb.requests < cb.cfg.MinRequests {
+		return
+	}
+
+	errorRate := float64(cb.failures) / float64(cb.requests)
+	slowRate := float64(cb.slowCalls) / float64(cb.requests)
+	if errorRate >= cb.cfg.ErrorRateThreshold || (cb.cfg.SlowCallRateThreshold > 0 && slowRate >= cb.cfg.SlowCallRateThreshold) {
+		cb.transition(CircuitOpen)
+	}
+}
+
+func (cb *CircuitBreaker) recordHalfOpen(failed bool, latency time.Duration) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state != CircuitHalfOpen {
+		return
+	}
+
+	slow := cb.cfg.SlowCallMs > 0 && latency >= time.Duration(cb.cfg.SlowCallMs)*time.Millisecond
+	if failed || slow {
+		cb.transition(CircuitOpen)
+		return
+	}
+
+	cb.halfOpenOK++
+	if cb.halfOpenOK >= cb.cfg.HalfOpenRequests {
+		cb.transition(CircuitClosed)
+	}
+}
+
+func (cb *CircuitBreaker) transition(state string) {
+	if cb.state == state {
+		return
+	}
+
+	log.Printf("Circuit breaker %s: %s → %s", cb.name, cb.state, state)
+	cb.state = state
+	cb.halfOpenActive = 0
+	cb.halfOpenOK = 0
+	if state == CircuitOpen {
+		cb.openedAt = time.Now()
+	}
+	cb.resetWindow(time.Now())
+}
+
+func (cb *CircuitBreaker) resetWindow(now time.Time) {
+	cb.windowStart = now
+	cb.requests = 0
+	cb.failures = 0
+	cb.slowCalls = 0
+}
+
+func (cb *CircuitBreaker) SetMode(mode string) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch mode {
+	case CircuitModeAuto:
+		cb.transition(CircuitClosed)
+	case CircuitModeOpen, CircuitModeClosed:
+	default:
+		return fmt.Errorf("unknown circuit breaker mode %q", mode)
+	}
+
+	log.Printf("Circuit breaker %s: mode set to %s", cb.name, mode)
+	cb.mode = mode
+	return nil
+}
+
+func (cb *CircuitBreaker) Status() CircuitBreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	status := CircuitBreakerStatus{
+		State:    cb.state,
+		Mode:     cb.mode,
+		Requests: cb.requests,
+		Rejected: cb.rejected,
+	}
+	switch cb.mode {
+	case CircuitModeOpen:
+		status.State = CircuitOpen
+	case CircuitModeClosed:
+		status.State = CircuitClosed
+	}
+	if cb.requests > 0 {
+		status.ErrorRate = float64(cb.failures) / float64(cb.requests)
+		status.SlowRate = float64(cb.slowCalls) / float64(cb.requests)
+	}
+	return status
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+type clientIPKey struct{}
+
+type clientAddr struct {
+	ip      string
+	proxied bool
+}
+
+// WithClientIP records the caller's address as resolved from the trusted
+// proxies, and whether the connection came from one of them.
+func WithClientIP(ctx context.Context, ip string, proxied bool) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, clientAddr{ip: ip, proxied: proxied})
+}
+
+// ClientIP returns the address recorded by WithClientIP, or the connection's
+// address if none was.
+func ClientIP(r *http.Request) string {
+	if addr, ok := r.Context().Value(clientIPKey{}).(clientAddr); ok {
+		return addr.ip
+	}
+	return RemoteIP(r)
+}
+
+func fromTrustedProxy(r *http.Request) bool {
+	addr, ok := r.Context().Value(clientIPKey{}).(clientAddr)
+	return ok && addr.proxied
+}
+
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
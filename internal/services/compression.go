@@ -0,0 +1,224 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"api-gateway/internal/config"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	EncodingGzip   = "gzip"
+	EncodingBrotli = "br"
+	EncodingZstd   = "zstd"
+)
+
+var incompressibleTypes = []string{
+	"image/", "video/", "audio/", "font/woff", "font/woff2",
+	"application/zip", "application/gzip", "application/x-gzip", "application/zstd",
+	"application/x-bzip2", "application/x-xz", "application/x-7z-compressed",
+	"application/x-rar-compressed", "application/pdf", "application/octet-stream",
+	"application/grpc", "text/event-stream",
+}
+
+type Compressor struct {
+	encodings []string
+	minBytes  int
+	pools     map[string]*sync.Pool
+}
+
+// EncodeWriter is a compressing writer that can flush partial output for
+// streamed responses.
+type EncodeWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func NewCompressor(cfg config.CompressionConfig) (*Compressor, error) {
+	c := &Compressor{
+		minBytes: cfg.MinBytes,
+		pools:    make(map[string]*sync.Pool),
+	}
+	if !cfg.Enabled {
+		return c, nil
+	}
+
+	for _, encoding := range cfg.Encodings {
+		encoding = strings.ToLower(encoding)
+		var newWriter func() interface{}
+		switch encoding {
+		case EncodingGzip:
+			newWriter = func() interface{} { return gzip.NewWriter(io.Discard) }
+		case EncodingBrotli:
+			newWriter = func() interface{} { return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression) }
+		case EncodingZstd:
+			newWriter = func() interface{} {
+				encoder, _ := zstd.NewWriter(io.Discard, zstd.WithEncoderConcurrency(1), zstd.WithLowerEncoderMem(true))
+				return encoder
+			}
+		default:
+			return nil, fmt.Errorf("unsupported compression encoding %q", encoding)
+		}
+		c.encodings = append(c.encodings, encoding)
+		c.pools[encoding] = &sync.Pool{New: newWriter}
+	}
+	return c, nil
+}
+
+// Negotiate picks the encoding the client prefers from Accept-Encoding,
+// breaking ties with the configured order. It returns "" if nothing matches.
+func (c *Compressor) Negotiate(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, encoding := range c.encodings {
+		if q := encodingQuality(acceptEncoding, encoding); q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// StorageEncoding is the encoding cached bodies are stored with.
+func (c *Compressor) StorageEncoding() string {
+	if len(c.encodings) == 0 {
+		return ""
+	}
+	return c.encodings[0]
+}
+
+func (c *Compressor) Enabled() bool {
+	return len(c.encodings) > 0
+}
+
+func (c *Compressor) ShouldCompress(header http.Header, statusCode int) bool {
+	if statusCode < 200 || statusCode == http.StatusNoContent || statusCode == http.StatusPartialContent || statusCode == http.StatusNotModified {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	if strings.Contains(strings.ToLower(header.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < c.minBytes {
+		return false
+	}
+	return IsCompressibleType(header.Get("Content-Type"))
+}
+
+func IsCompressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Compressor) NewWriter(encoding string, w io.Writer) EncodeWriter {
+	pool := c.pools[encoding]
+	switch writer := pool.Get().(type) {
+	case *gzip.Writer:
+		writer.Reset(w)
+		return &pooledWriter{EncodeWriter: writer, pool: pool}
+	case *brotli.Writer:
+		writer.Reset(w)
+		return &pooledWriter{EncodeWriter: writer, pool: pool}
+	case *zstd.Encoder:
+		writer.Reset(w)
+		return &pooledWriter{EncodeWriter: writer, pool: pool}
+	}
+	return nil
+}
+
+type pooledWriter struct {
+	EncodeWriter
+	pool *sync.Pool
+}
+
+func (pw *pooledWriter) Close() error {
+	err := pw.EncodeWriter.Close()
+	pw.pool.Put(pw.EncodeWriter)
+	return err
+}
+
+func (c *Compressor) Compress(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := c.NewWriter(encoding, &buf)
+	if writer == nil {
+		return nil, fmt.Errorf("unsupported compression encoding %q", encoding)
+	}
+	if _, err := writer.Write(data); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func NewDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch strings.ToLower(encoding) {
+	case EncodingGzip, "x-gzip":
+		return gzip.NewReader(r)
+	case EncodingBrotli:
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case EncodingZstd:
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+func AcceptsEncoding(acceptEncoding, encoding string) bool {
+	return encodingQuality(acceptEncoding, encoding) > 0
+}
+
+func encodingQuality(acceptEncoding, encoding string) float64 {
+	wildcard := -1.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != encoding && name != "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(key, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if name == encoding {
+			return q
+		}
+		wildcard = q
+	}
+	if wildcard < 0 {
+		return 0
+	}
+	return wildcard
+}
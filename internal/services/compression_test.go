@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"api-gateway/internal/config"
+)
+
+func TestEncodingQuality(t *testing.T) {
+	tests := []struct {
+		accept   string
+		encoding string
+		want     float64
+	}{
+		{accept: "", encoding: "gzip", want: 0},
+		{accept: "gzip", encoding: "gzip", want: 1},
+		{accept: "GZIP", encoding: "gzip", want: 1},
+		{accept: "gzip;q=0.5", encoding: "gzip", want: 0.5},
+		{accept: "gzip ; q=0.5", encoding: "gzip", want: 0.5},
+		{accept: "gzip;q=0", encoding: "gzip", want: 0},
+		{accept: "br", encoding: "gzip", want: 0},
+		{accept: "*", encoding: "gzip", want: 1},
+		{accept: "*;q=0.3", encoding: "gzip", want: 0.3},
+		{accept: "*;q=0", encoding: "gzip", want: 0},
+		{accept: "gzip;q=0, *", encoding: "gzip", want: 0},
+		{accept: "*, gzip;q=0", encoding: "gzip", want: 0},
+		{accept: "*;q=0, gzip", encoding: "gzip", want: 1},
+		{accept: "*;q=0.1, gzip;q=0.8", encoding: "gzip", want: 0.8},
+		{accept: "gzip;q=bogus", encoding: "gzip", want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept+"/"+tt.encoding, func(t *testing.T) {
+			if got := encodingQuality(tt.accept, tt.encoding); got != tt.want {
+				t.Fatalf("encodingQuality(%q, %q) = %v, want %v", tt.accept, tt.encoding, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressorNegotiate(t *testing.T) {
+	compressor, err := NewCompressor(config.CompressionConfig{Enabled: true, Encodings: []string{"br", "zstd", "gzip"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: ""},
+		{accept: "identity", want: ""},
+		{accept: "gzip", want: "gzip"},
+		{accept: "gzip, deflate, br, zstd", want: "br"},
+		{accept: "gzip, zstd", want: "zstd"},
+		{accept: "br;q=0.5, gzip", want: "gzip"},
+		{accept: "br;q=0, zstd;q=0, gzip;q=0", want: ""},
+		{accept: "*", want: "br"},
+		{accept: "*;q=0", want: ""},
+		{accept: "*;q=0.5, gzip", want: "gzip"},
+		{accept: "br;q=0, *", want: "zstd"},
+		{accept: "*, br;q=0", want: "zstd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if got := compressor.Negotiate(tt.accept); got != tt.want {
+				t.Fatalf("Negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompressorDisabled(t *testing.T) {
+	compressor, err := NewCompressor(config.CompressionConfig{Enabled: false, Encodings: []string{"gzip"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compressor.Enabled() || compressor.StorageEncoding() != "" || compressor.Negotiate("gzip") != "" {
+		t.Fatal("disabled compressor should not negotiate or store an encoding")
+	}
+
+	if _, err := NewCompressor(config.CompressionConfig{Enabled: true, Encodings: []string{"deflate"}}); err == nil {
+		t.Fatal("expected an error for an unsupported encoding")
+	}
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+	compressor, err := NewCompressor(config.CompressionConfig{Enabled: true, Encodings: []string{"br", "zstd", "gzip"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte(`{"id":1,"name":"gateway"}`), 100)
+	for _, encoding := range []string{EncodingBrotli, EncodingZstd, EncodingGzip} {
+		t.Run(encoding, func(t *testing.T) {
+			// Twice, so the second run uses a writer from the pool.
+			for i := 0; i < 2; i++ {
+				compressed, err := compressor.Compress(encoding, data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(compressed) >= len(data) {
+					t.Fatalf("compressed to %d bytes from %d", len(compressed), len(data))
+				}
+
+				decoder, err := NewDecoder(encoding, bytes.NewReader(compressed))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := io.ReadAll(decoder)
+				decoder.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Fatal("round trip changed the body")
+				}
+			}
+		})
+	}
+}
+
+func TestShouldCompress(t *testing.T) {
+	compressor, err := NewCompressor(config.CompressionConfig{Enabled: true, Encodings: []string{"gzip"}, MinBytes: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+		want   bool
+	}{
+		{name: "json", header: http.Header{"Content-Type": {"application/json"}}, status: 200, want: true},
+		{name: "svg", header: http.Header{"Content-Type": {"image/svg+xml"}}, status: 200, want: true},
+		{name: "png", header: http.Header{"Content-Type": {"image/png"}}, status: 200, want: false},
+		{name: "small", header: http.Header{"Content-Type": {"application/json"}, "Content-Length": {"10"}}, status: 200, want: false},
+		{name: "already encoded", header: http.Header{"Content-Type": {"application/json"}, "Content-Encoding": {"br"}}, status: 200, want: false},
+		{name: "no-transform", header: http.Header{"Content-Type": {"application/json"}, "Cache-Control": {"public, no-transform"}}, status: 200, want: false},
+		{name: "no content", header: http.Header{"Content-Type": {"application/json"}}, status: 204, want: false},
+		{name: "partial", header: http.Header{"Content-Type": {"application/json"}}, status: 206, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := compressor.ShouldCompress(tt.header, tt.status); got != tt.want {
+				t.Fatalf("ShouldCompress = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// liftableDeadline is a context deadline that can be dropped later. The
+// total upstream timeout covers a request until its response turns out to be
+// a stream, which is then allowed to stay open.
+type liftableDeadline struct {
+	context.Context
+	cancel   context.CancelCauseFunc
+	done     chan struct{}
+	timer    *time.Timer
+	deadline time.Time
+	expired  atomic.Bool
+	lifted   atomic.Bool
+}
+
+func withLiftableDeadline(parent context.Context, timeout time.Duration) *liftableDeadline {
+	ctx, cancel := context.WithCancelCause(parent)
+	d := &liftableDeadline{
+		Context:  ctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		deadline: time.Now().Add(timeout),
+	}
+	// A separate Done channel keeps the context package from short-circuiting
+	// to the inner context, so children see DeadlineExceeded from Err.
+	context.AfterFunc(ctx, func() { close(d.done) })
+	d.timer = time.AfterFunc(timeout, func() {
+		if ctx.Err() == nil {
+			d.expired.Store(true)
+			cancel(context.DeadlineExceeded)
+		}
+	})
+	return d
+}
+
+func (d *liftableDeadline) Deadline() (time.Time, bool) {
+	parent, ok := d.Context.Deadline()
+	if d.lifted.Load() || ok && parent.Before(d.deadline) {
+		return parent, ok
+	}
+	return d.deadline, true
+}
+
+func (d *liftableDeadline) Done() <-chan struct{} {
+	return d.done
+}
+
+func (d *liftableDeadline) Err() error {
+	select {
+	case <-d.done:
+	default:
+		return nil
+	}
+	if d.expired.Load() {
+		return context.DeadlineExceeded
+	}
+	return d.Context.Err()
+}
+
+// Lift drops the deadline if it hasn't passed yet.
+func (d *liftableDeadline) Lift() {
+	if d.timer.Stop() {
+		d.lifted.Store(true)
+	}
+}
+
+func (d *liftableDeadline) Release() {
+	d.timer.Stop()
+	d.cancel(nil)
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+var grpcCodeNames = []string{
+	"OK",
+	"CANCELLED",
+	"UNKNOWN",
+	"INVALID_ARGUMENT",
+	"DEADLINE_EXCEEDED",
+	"NOT_FOUND",
+	"ALREADY_EXISTS",
+	"PERMISSION_DENIED",
+	"RESOURCE_EXHAUSTED",
+	"FAILED_PRECONDITION",
+	"ABORTED",
+	"OUT_OF_RANGE",
+	"UNIMPLEMENTED",
+	"INTERNAL",
+	"UNAVAILABLE",
+	"DATA_LOSS",
+	"UNAUTHENTICATED",
+}
+
+func IsGRPCRequest(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// GRPCTimeout parses the client's grpc-timeout header, e.g. "250m" or "30S".
+func GRPCTimeout(header http.Header) (time.Duration, bool) {
+	value := header.Get("Grpc-Timeout")
+	if len(value) < 2 || len(value) > 9 {
+		return 0, false
+	}
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+func GRPCCodeName(code string) string {
+	n, err := strconv.Atoi(code)
+	if err != nil || n < 0 || n >= len(grpcCodeNames) {
+		return "CODE_" + code
+	}
+	return grpcCodeNames[n]
+}
+
+// GRPCStatus reads grpc-status from the trailers, falling back to the headers
+// for trailers-only responses.
+func GRPCStatus(header http.Header) string {
+	if status := header.Get(http.TrailerPrefix + "Grpc-Status"); status != "" {
+		return status
+	}
+	return header.Get("Grpc-Status")
+}
+
+func GRPCCodeForHTTPStatus(status int) int {
+	switch status {
+	case http.StatusBadRequest:
+		return 13
+	case http.StatusUnauthorized:
+		return 16
+	case http.StatusForbidden:
+		return 7
+	case http.StatusNotFound:
+		return 12
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests:
+		return 8
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return 14
+	case http.StatusGatewayTimeout:
+		return 4
+	case http.StatusInternalServerError:
+		return 13
+	default:
+		return 2
+	}
+}
+
+func HTTPStatusForGRPCCode(code int) int {
+	switch code {
+	case 0:
+		return http.StatusOK
+	case 1:
+		return 499
+	case 3, 9, 11:
+		return http.StatusBadRequest
+	case 4:
+		return http.StatusGatewayTimeout
+	case 5:
+		return http.StatusNotFound
+	case 6, 10:
+		return http.StatusConflict
+	case 7:
+		return http.StatusForbidden
+	case 8:
+		return http.StatusTooManyRequests
+	case 12:
+		return http.StatusNotImplemented
+	case 14:
+		return http.StatusServiceUnavailable
+	case 16:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func EncodeGRPCMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func acceptsTrailers(header http.Header) bool {
+	for _, value := range header.Values("Te") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/models"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+var placeholderPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+type HeaderPolicy struct {
+	remove  []string
+	renames []headerRename
+	set     map[string]headerTemplate
+	add     map[string]headerTemplate
+}
+
+type headerRename struct {
+	from string
+	to   string
+}
+
+type headerTemplate []string
+
+type templateContext struct {
+	r         *http.Request
+	route     *config.RouteConfig
+	principal *models.Principal
+}
+
+func NewHeaderPolicy(cfg *config.HeaderRulesConfig) (*HeaderPolicy, error) {
+	hp := &HeaderPolicy{
+		set: make(map[string]headerTemplate),
+		add: make(map[string]headerTemplate),
+	}
+
+	for _, name := range cfg.Remove {
+		hp.remove = append(hp.remove, http.CanonicalHeaderKey(name))
+	}
+	// Renames run sorted by source header so overlapping ones like A→B and
+	// B→C always give the same result.
+	sources := make([]string, 0, len(cfg.Rename))
+	for from := range cfg.Rename {
+		sources = append(sources, from)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return http.CanonicalHeaderKey(sources[i]) < http.CanonicalHeaderKey(sources[j])
+	})
+	targets := make(map[string]string)
+	for _, from := range sources {
+		to := http.CanonicalHeaderKey(cfg.Rename[from])
+		if other, ok := targets[to]; ok {
+			return nil, fmt.Errorf("rename of %q and %q both target %q", other, from, to)
+		}
+		targets[to] = from
+		hp.renames = append(hp.renames, headerRename{from: http.CanonicalHeaderKey(from), to: to})
+	}
+	for name, value := range cfg.Set {
+		tmpl, err := parseHeaderTemplate(value)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		hp.set[http.CanonicalHeaderKey(name)] = tmpl
+	}
+	for name, value := range cfg.Add {
+		tmpl, err := parseHeaderTemplate(value)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", name, err)
+		}
+		hp.add[http.CanonicalHeaderKey(name)] = tmpl
+	}
+
+	return hp, nil
+}
+
+// parseHeaderTemplate splits a value into alternating literal and placeholder
+// parts. ${env:NAME} is resolved once here so secrets never sit in the config
+// file.
+func parseHeaderTemplate(value string) (headerTemplate, error) {
+	var tmpl headerTemplate
+	last := 0
+	for _, loc := range placeholderPattern.FindAllStringSubmatchIndex(value, -1) {
+		literal := value[last:loc[0]]
+		name := value[loc[2]:loc[3]]
+		last = loc[1]
+
+		if env, ok := strings.CutPrefix(name, "env:"); ok {
+			tmpl = appendLiteral(tmpl, literal+os.Getenv(env))
+			continue
+		}
+		if !knownPlaceholder(name) {
+			return nil, fmt.Errorf("unknown placeholder ${%s}", name)
+		}
+		tmpl = append(appendLiteral(tmpl, literal), name)
+	}
+	return appendLiteral(tmpl, value[last:]), nil
+}
+
+func appendLiteral(tmpl headerTemplate, literal string) headerTemplate {
+	if len(tmpl)%2 == 1 {
+		tmpl[len(tmpl)-1] += literal
+		return tmpl
+	}
+	return append(tmpl, literal)
+}
+
+func knownPlaceholder(name string) bool {
+	switch name {
+	case "principal.id", "principal.name", "principal.type", "principal.auth_method",
+		"principal.tenant", "principal.scopes", "client_ip", "request_id", "route":
+		return true
+	}
+	return strings.HasPrefix(name, "header:")
+}
+
+func (tmpl headerTemplate) render(tc templateContext) string {
+	var b strings.Builder
+	for i, part := range tmpl {
+		if i%2 == 0 {
+			b.WriteString(part)
+		} else {
+			b.WriteString(tc.lookup(part))
+		}
+	}
+	return b.String()
+}
+
+func (tc templateContext) lookup(name string) string {
+	principal := tc.principal
+	if principal == nil {
+		principal = &models.Principal{}
+	}
+
+	switch name {
+	case "principal.id":
+		return principal.ID
+	case "principal.name":
+		return principal.Name
+	case "principal.type":
+		return principal.Type
+	case "principal.auth_method":
+		return principal.AuthMethod
+	case "principal.tenant":
+		return principal.Tenant
+	case "principal.scopes":
+		return strings.Join(principal.Scopes, " ")
+	case "client_ip":
+		return ClientIP(tc.r)
+	case "request_id":
+		return tc.r.Header.Get(RequestIDHeader)
+	case "route":
+		if tc.route == nil {
+			return ""
+		}
+		return tc.route.Name
+	default:
+		return tc.r.Header.Get(strings.TrimPrefix(name, "header:"))
+	}
+}
+
+func (hp *HeaderPolicy) Apply(header http.Header, tc templateContext) {
+	for _, name := range hp.remove {
+		header.Del(name)
+	}
+	for _, rename := range hp.renames {
+		if values, ok := header[rename.from]; ok {
+			header.Del(rename.from)
+			header[rename.to] = append(header[rename.to], values...)
+		}
+	}
+	for name, tmpl := range hp.set {
+		header.Set(name, sanitizeHeaderValue(tmpl.render(tc)))
+	}
+	for name, tmpl := range hp.add {
+		header.Add(name, sanitizeHeaderValue(tmpl.render(tc)))
+	}
+}
+
+func sanitizeHeaderValue(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' || r == 0 {
+			return -1
+		}
+		return r
+	}, value)
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-gateway/internal/config"
+)
+
+type targetHealth struct {
+	unhealthy    int32
+	failures     int32
+	ejectedUntil int64
+
+	checkSuccesses int
+	checkFailures  int
+}
+
+func (t *Target) Available() bool {
+	if atomic.LoadInt32(&t.health.unhealthy) == 1 {
+		return false
+	}
+	return time.Now().UnixNano() >= atomic.LoadInt64(&t.health.ejectedUntil)
+}
+
+func (t *Target) Status() string {
+	switch {
+	case atomic.LoadInt32(&t.health.unhealthy) == 1:
+		return "unhealthy"
+	case time.Now().UnixNano() < atomic.LoadInt64(&t.health.ejectedUntil):
+		return "ejected"
+	default:
+		return "healthy"
+	}
+}
+
+func (u *Upstream) ReportResult(target *Target, failed bool) {
+	outlier := u.outlier
+	if outlier == nil || outlier.ConsecutiveFailures <= 0 {
+		return
+	}
+
+	if !failed {
+		atomic.StoreInt32(&target.health.failures, 0)
+		return
+	}
+
+	if atomic.AddInt32(&target.health.failures, 1) < int32(outlier.ConsecutiveFailures) {
+		return
+	}
+
+	atomic.StoreInt32(&target.health.failures, 0)
+	ejection := time.Duration(outlier.EjectionSeconds) * time.Second
+	if ejection <= 0 {
+		ejection = 30 * time.Second
+	}
+	atomic.StoreInt64(&target.health.ejectedUntil, time.Now().Add(ejection).UnixNano())
+	log.Printf("Ejected %s from upstream %s for %s after %d consecutive failures", target.URL, u.Name, ejection, outlier.ConsecutiveFailures)
+}
+
+type UpstreamHealth struct {
+	Status  string            `json:"status"`
+	Targets map[string]string `json:"targets"`
+}
+
+func (u *Upstream) Health() UpstreamHealth {
+	health := UpstreamHealth{Targets: make(map[string]string)}
+
+	available := 0
+	for _, target := range u.Targets {
+		status := target.Status()
+		health.Targets[target.URL.String()] = status
+		if status == "healthy" {
+			available++
+		}
+	}
+
+	switch available {
+	case len(u.Targets):
+		health.Status = "ok"
+	case 0:
+		health.Status = "down"
+	default:
+		health.Status = "degraded"
+	}
+
+	return health
+}
+
+type HealthChecker struct {
+	upstreams map[string]*Upstream
+	clients   map[string]*http.Client
+	wg        sync.WaitGroup
+	cancel    context.CancelFunc
+}
+
+func NewHealthChecker(upstreams map[string]*Upstream) *HealthChecker {
+	clients := make(map[string]*http.Client)
+	for name, upstream := range upstreams {
+		clients[name] = &http.Client{
+			Transport: newTransport(upstream.Protocol, config.TimeoutConfig{}, upstream.tlsConfig),
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	return &HealthChecker{
+		upstreams: upstreams,
+		clients:   clients,
+	}
+}
+
+func (hc *HealthChecker) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	hc.cancel = cancel
+
+	for _, upstream := range hc.upstreams {
+		if upstream.healthCheck == nil {
+			continue
+		}
+		hc.wg.Add(1)
+		go hc.run(ctx, upstream)
+	}
+}
+
+func (hc *HealthChecker) Stop() {
+	if hc.cancel != nil {
+		hc.cancel()
+	}
+	hc.wg.Wait()
+}
+
+func (hc *HealthChecker) run(ctx context.Context, upstream *Upstream) {
+	defer hc.wg.Done()
+
+	interval := time.Duration(upstream.healthCheck.IntervalSeconds) * time.Second
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for _, target := range upstream.Targets {
+			hc.check(ctx, upstream, target)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (hc *HealthChecker) check(ctx context.Context, upstream *Upstream, target *Target) {
+	cfg := upstream.healthCheck
+
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	checkURL := *target.URL
+	checkURL.Path = strings.TrimSuffix(checkURL.Path, "/") + "/" + strings.TrimPrefix(cfg.Path, "/")
+	checkURL.RawPath = ""
+
+	ok := false
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL.String(), nil)
+	if err == nil {
+		var resp *http.Response
+		resp, err = hc.clients[upstream.Name].Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if cfg.ExpectedStatus > 0 {
+				ok = resp.StatusCode == cfg.ExpectedStatus
+			} else {
+				ok = resp.StatusCode >= 200 && resp.StatusCode < 300
+			}
+		}
+	}
+
+	if ctx.Err() == context.Canceled {
+		return
+	}
+
+	hc.record(upstream, target, ok)
+}
+
+func (hc *HealthChecker) record(upstream *Upstream, target *Target, ok bool) {
+	cfg := upstream.healthCheck
+	healthyThreshold := max(cfg.HealthyThreshold, 1)
+	unhealthyThreshold := max(cfg.UnhealthyThreshold, 1)
+
+	if ok {
+		target.health.checkFailures = 0
+		target.health.checkSuccesses++
+		if target.health.checkSuccesses >= healthyThreshold && atomic.CompareAndSwapInt32(&target.health.unhealthy, 1, 0) {
+			atomic.StoreInt64(&target.health.ejectedUntil, 0)
+			log.Printf("Upstream %s target %s is healthy", upstream.Name, target.URL)
+		}
+		return
+	}
+
+	target.health.checkSuccesses = 0
+	target.health.checkFailures++
+	if target.health.checkFailures >= unhealthyThreshold && atomic.CompareAndSwapInt32(&target.health.unhealthy, 0, 1) {
+		log.Printf("Upstream %s target %s is unhealthy", upstream.Name, target.URL)
+	}
+}
+
+func newHealthCheckConfig(cfg *config.HealthCheckConfig) *config.HealthCheckConfig {
+	if cfg == nil || cfg.Path == "" {
+		return nil
+	}
+	return cfg
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/models"
+)
+
+const (
+	hedgeSampleSize    = 512
+	hedgeDelayCacheTTL = time.Second
+)
+
+type HedgePolicy struct {
+	percentile float64
+	fallback   time.Duration
+	minSamples int
+
+	mu       sync.Mutex
+	samples  []time.Duration
+	next     int
+	delay    time.Duration
+	computed time.Time
+}
+
+func NewHedgePolicy(cfg config.HedgeConfig) *HedgePolicy {
+	policy := &HedgePolicy{
+		percentile: cfg.Percentile,
+		fallback:   time.Duration(cfg.DelayMs) * time.Millisecond,
+		minSamples: cfg.MinSamples,
+		samples:    make([]time.Duration, 0, hedgeSampleSize),
+	}
+	if policy.percentile <= 0 || policy.percentile >= 100 {
+		policy.percentile = 95
+	}
+	if policy.fallback <= 0 {
+		policy.fallback = 100 * time.Millisecond
+	}
+	if policy.minSamples <= 0 {
+		policy.minSamples = 50
+	}
+	return policy
+}
+
+func (hp *HedgePolicy) AppliesTo(method string) bool {
+	return hp != nil && (method == http.MethodGet || method == http.MethodHead)
+}
+
+func (hp *HedgePolicy) Record(latency time.Duration) {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+
+	if len(hp.samples) < hedgeSampleSize {
+		hp.samples = append(hp.samples, latency)
+		return
+	}
+	hp.samples[hp.next] = latency
+	hp.next = (hp.next + 1) % hedgeSampleSize
+}
+
+func (hp *HedgePolicy) Delay() time.Duration {
+	hp.mu.Lock()
+	defer hp.mu.Unlock()
+
+	if len(hp.samples) < hp.minSamples {
+		return hp.fallback
+	}
+	if time.Since(hp.computed) < hedgeDelayCacheTTL {
+		return hp.delay
+	}
+
+	sorted := make([]time.Duration, len(hp.samples))
+	copy(sorted, hp.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	index := int(float64(len(sorted)-1) * hp.percentile / 100)
+	hp.delay = sorted[index]
+	hp.computed = time.Now()
+	return hp.delay
+}
+
+type hedgeResult struct {
+	resp   *http.Response
+	target *Target
+	err    error
+	hedged bool
+}
+
+func (p *ProxyService) hedgedAttempt(ctx context.Context, client *http.Client, r *http.Request, route *config.RouteConfig, upstream *Upstream, principal *models.Principal, body *replayableBody, exclude map[*Target]bool, policy *HedgePolicy) (*http.Response, *Target, error) {
+	results := make(chan hedgeResult, 2)
+	cancels := make(map[bool]context.CancelFunc)
+	launch := func(target *Target, hedged bool) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels[hedged] = cancel
+		go func() {
+			start := time.Now()
+			resp, err := p.attempt(attemptCtx, client, r, route, upstream, principal, body, target)
+			if err == nil {
+				policy.Record(time.Since(start))
+			}
+			results <- hedgeResult{resp: resp, target: target, err: err, hedged: hedged}
+		}()
+	}
+	cancelAll := func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}
+
+	key := hashKey(upstream.HashOn, r, principal)
+	primary := upstream.Pick(key, exclude)
+	launch(primary, false)
+
+	timer := time.NewTimer(policy.Delay())
+	defer timer.Stop()
+
+	inflight := 1
+	fired := false
+
+	for {
+		select {
+		case <-timer.C:
+			if fired || inflight == 0 {
+				continue
+			}
+			fired = true
+
+			hedgeExclude := map[*Target]bool{primary: true}
+			for target := range exclude {
+				hedgeExclude[target] = true
+			}
+			secondary := upstream.Pick(key, hedgeExclude)
+			if secondary == primary {
+				continue
+			}
+			p.metrics.RecordHedgeFired()
+			launch(secondary, true)
+			inflight++
+		case result := <-results:
+			inflight--
+			if result.err == nil {
+				if result.hedged {
+					p.metrics.RecordHedgeWon()
+				}
+				winner := cancels[result.hedged]
+				for hedged, cancel := range cancels {
+					if hedged != result.hedged {
+						cancel()
+					}
+				}
+				if inflight > 0 {
+					go discardHedgeResults(results, inflight)
+				}
+				result.resp.Body = &releasingBody{ReadCloser: result.resp.Body, release: winner}
+				return result.resp, result.target, nil
+			}
+
+			if inflight > 0 {
+				continue
+			}
+			cancelAll()
+			return nil, result.target, result.err
+		case <-ctx.Done():
+			cancelAll()
+			if inflight > 0 {
+				go discardHedgeResults(results, inflight)
+			}
+			err := ctx.Err()
+			if errors.Is(err, context.DeadlineExceeded) {
+				err = fmt.Errorf("%w: %v", ErrUpstreamTimeout, err)
+			}
+			return nil, primary, err
+		}
+	}
+}
+
+func discardHedgeResults(results <-chan hedgeResult, count int) {
+	for i := 0; i < count; i++ {
+		if result := <-results; result.resp != nil {
+			result.resp.Body.Close()
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var gatewayCredentialHeaders = []string{
+	"X-API-Key",
+	SignatureDateHeader,
+	SignatureNonceHeader,
+	SignatureBodyHeader,
+}
+
+var bearerAuthMethods = map[string]bool{
+	"jwt":    true,
+	"oauth2": true,
+	"hmac":   true,
+}
+
+type IdentityHeaders struct {
+	cfg         config.IdentityConfig
+	apiKeyQuery string
+}
+
+func NewIdentityHeaders(cfg config.IdentityConfig, apiKeyQuery string) *IdentityHeaders {
+	return &IdentityHeaders{
+		cfg:         cfg,
+		apiKeyQuery: apiKeyQuery,
+	}
+}
+
+func (ih *IdentityHeaders) Apply(req *http.Request, principal *models.Principal) error {
+	for _, header := range gatewayCredentialHeaders {
+		req.Header.Del(header)
+	}
+	if principal != nil && bearerAuthMethods[principal.AuthMethod] {
+		req.Header.Del("Authorization")
+	}
+
+	if ih.apiKeyQuery != "" {
+		query := req.URL.Query()
+		if query.Has(ih.apiKeyQuery) {
+			query.Del(ih.apiKeyQuery)
+			req.URL.RawQuery = query.Encode()
+		}
+	}
+
+	for _, header := range ih.headerNames() {
+		req.Header.Del(header)
+	}
+
+	if principal == nil {
+		return nil
+	}
+
+	setIfConfigured(req.Header, ih.cfg.KeyIDHeader, principal.ID)
+	setIfConfigured(req.Header, ih.cfg.KeyNameHeader, principal.Name)
+	setIfConfigured(req.Header, ih.cfg.TypeHeader, principal.Type)
+	setIfConfigured(req.Header, ih.cfg.ScopesHeader, strings.Join(principal.Scopes, " "))
+	setIfConfigured(req.Header, ih.cfg.TenantHeader, principal.Tenant)
+
+	if ih.cfg.TokenHeader != "" && ih.cfg.TokenSecret != "" {
+		token, err := ih.sign(principal)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(ih.cfg.TokenHeader, token)
+	}
+
+	return nil
+}
+
+func (ih *IdentityHeaders) headerNames() []string {
+	return []string{
+		ih.cfg.KeyIDHeader,
+		ih.cfg.KeyNameHeader,
+		ih.cfg.TypeHeader,
+		ih.cfg.ScopesHeader,
+		ih.cfg.TenantHeader,
+		ih.cfg.TokenHeader,
+	}
+}
+
+func (ih *IdentityHeaders) sign(principal *models.Principal) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":  principal.ID,
+		"name": principal.Name,
+		"typ":  principal.Type,
+		"iat":  now.Unix(),
+		"exp":  now.Add(time.Duration(ih.cfg.TokenTTLSeconds) * time.Second).Unix(),
+	}
+	if ih.cfg.TokenIssuer != "" {
+		claims["iss"] = ih.cfg.TokenIssuer
+	}
+	if len(principal.Scopes) > 0 {
+		claims["scope"] = strings.Join(principal.Scopes, " ")
+	}
+	if principal.Tenant != "" {
+		claims["tenant"] = principal.Tenant
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(ih.cfg.TokenSecret))
+}
+
+func setIfConfigured(header http.Header, name, value string) {
+	if name != "" && value != "" {
+		header.Set(name, value)
+	}
+}
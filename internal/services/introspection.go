@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type IntrospectionResult struct {
+	Active   bool   `json:"active"`
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Subject  string `json:"sub,omitempty"`
+	Expiry   int64  `json:"exp,omitempty"`
+}
+
+type TokenIntrospector struct {
+	cfg    config.OAuth2Config
+	client *http.Client
+	redis  *redis.Client
+}
+
+func NewTokenIntrospector(cfg config.OAuth2Config, redisClient *redis.Client) *TokenIntrospector {
+	return &TokenIntrospector{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+		redis:  redisClient,
+	}
+}
+
+func (ti *TokenIntrospector) Introspect(ctx context.Context, token string) (*IntrospectionResult, error) {
+	hash := sha256.Sum256([]byte(token))
+	cacheKey := fmt.Sprintf("introspect:%x", hash[:16])
+
+	if data, err := ti.redis.Get(ctx, cacheKey).Bytes(); err == nil {
+		var cached IntrospectionResult
+		if err := json.Unmarshal(data, &cached); err == nil {
+			return &cached, nil
+		}
+	}
+
+	result, err := ti.fetch(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Active && result.Expiry > 0 && time.Unix(result.Expiry, 0).Before(time.Now()) {
+		result.Active = false
+	}
+
+	if ttl := ti.cacheTTL(result); ttl > 0 {
+		if data, err := json.Marshal(result); err == nil {
+			ti.redis.Set(ctx, cacheKey, data, ttl)
+		}
+	}
+
+	return result, nil
+}
+
+func (ti *TokenIntrospector) fetch(ctx context.Context, token string) (*IntrospectionResult, error) {
+	form := url.Values{
+		"token":           {token},
+		"token_type_hint": {"access_token"},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ti.cfg.IntrospectionURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if ti.cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(ti.cfg.ClientID), url.QueryEscape(ti.cfg.ClientSecret))
+	}
+
+	resp, err := ti.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspection request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspection endpoint returned %d", resp.StatusCode)
+	}
+
+	var result IntrospectionResult
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid introspection response: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (ti *TokenIntrospector) cacheTTL(result *IntrospectionResult) time.Duration {
+	maxTTL := time.Duration(ti.cfg.MaxCacheSeconds) * time.Second
+
+	if !result.Active {
+		return time.Duration(ti.cfg.NegativeCacheSeconds) * time.Second
+	}
+	if result.Expiry == 0 {
+		return maxTTL
+	}
+
+	ttl := time.Until(time.Unix(result.Expiry, 0))
+	if ttl > maxTTL {
+		return maxTTL
+	}
+	return ttl
+}
+
+func (ti *TokenIntrospector) Principal(result *IntrospectionResult) (*models.Principal, error) {
+	id := result.Subject
+	if id == "" {
+		id = result.ClientID
+	}
+	if id == "" {
+		return nil, fmt.Errorf("token has no sub or client_id")
+	}
+
+	name := result.Username
+	if name == "" {
+		name = result.ClientID
+	}
+	if name == "" {
+		name = id
+	}
+
+	return &models.Principal{
+		ID:                 id,
+		Type:               "oauth2",
+		Name:               name,
+		Scopes:             strings.Fields(result.Scope),
+		RateLimitPerMinute: ti.cfg.RateLimitPerMinute,
+		RateLimitPerHour:   ti.cfg.RateLimitPerHour,
+	}, nil
+}
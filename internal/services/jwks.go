@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const jwksMinRefreshInterval = 10 * time.Second
+
+type JWKSCache struct {
+	url    string
+	file   string
+	ttl    time.Duration
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	fetchedAt   time.Time
+	lastAttempt time.Time
+	group       singleflight.Group
+}
+
+func NewJWKSCache(url, file string, ttl time.Duration) *JWKSCache {
+	return &JWKSCache{
+		url:    url,
+		file:   file,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]interface{}),
+	}
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+func (c *JWKSCache) Key(ctx context.Context, kid string) (interface{}, error) {
+	c.mu.RLock()
+	key, found := c.lookup(kid)
+	fresh := time.Since(c.fetchedAt) < c.ttl
+	c.mu.RUnlock()
+
+	if found && fresh {
+		return key, nil
+	}
+
+	if err := c.refresh(ctx); err != nil {
+		if found {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if key, found := c.lookup(kid); found {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: no signing key for kid %q", ErrUnknownToken, kid)
+}
+
+func (c *JWKSCache) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+// refresh fetches the key set outside the lock so lookups aren't blocked on
+// the network, and shares one fetch between concurrent callers.
+func (c *JWKSCache) refresh(ctx context.Context) error {
+	_, err, _ := c.group.Do("refresh", func() (interface{}, error) {
+		c.mu.Lock()
+		if time.Since(c.lastAttempt) < jwksMinRefreshInterval {
+			c.mu.Unlock()
+			return nil, nil
+		}
+		c.lastAttempt = time.Now()
+		c.mu.Unlock()
+
+		keys, err := c.fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		c.keys = keys
+		c.fetchedAt = time.Now()
+		c.mu.Unlock()
+		return nil, nil
+	})
+	return err
+}
+
+func (c *JWKSCache) fetch(ctx context.Context) (map[string]interface{}, error) {
+	data, err := c.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jsonWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseJSONWebKey(jwk)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q in JWKS: %w", jwk.Kid, err)
+		}
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (c *JWKSCache) load(ctx context.Context) ([]byte, error) {
+	if c.file != "" {
+		data, err := os.ReadFile(c.file)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read JWKS file: %w", err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func parseJSONWebKey(jwk jsonWebKey) (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("bad modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("bad exponent: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("bad x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("bad y coordinate: %w", err)
+		}
+		key := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("point is not on curve %s", jwk.Crv)
+		}
+		return key, nil
+	default:
+		return nil, nil
+	}
+}
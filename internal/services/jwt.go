@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUnknownToken means a token wasn't issued for this validator, either by
+// another issuer or with a key it doesn't hold, so another authenticator may
+// accept it.
+var ErrUnknownToken = errors.New("token not issued for this validator")
+
+type JWTValidator struct {
+	cfg        config.JWTConfig
+	parser     *jwt.Parser
+	hmacSecret []byte
+	jwks       *JWKSCache
+}
+
+func NewJWTValidator(cfg config.JWTConfig) *JWTValidator {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(cfg.Algorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Duration(cfg.LeewaySeconds) * time.Second),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+
+	v := &JWTValidator{
+		cfg:    cfg,
+		parser: jwt.NewParser(options...),
+	}
+
+	if cfg.HMACSecret != "" {
+		v.hmacSecret = []byte(cfg.HMACSecret)
+	}
+	if cfg.JWKSURL != "" || cfg.JWKSFile != "" {
+		v.jwks = NewJWKSCache(cfg.JWKSURL, cfg.JWKSFile, time.Duration(cfg.JWKSCacheSeconds)*time.Second)
+	}
+
+	return v
+}
+
+func (v *JWTValidator) Validate(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	if v.cfg.Issuer != "" {
+		unverified := jwt.MapClaims{}
+		if _, _, err := v.parser.ParseUnverified(tokenString, unverified); err == nil {
+			if issuer, _ := unverified.GetIssuer(); issuer != v.cfg.Issuer {
+				return nil, fmt.Errorf("%w: issuer %q", ErrUnknownToken, issuer)
+			}
+		}
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return v.signingKey(ctx, token)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	return claims, nil
+}
+
+func (v *JWTValidator) signingKey(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if v.hmacSecret == nil {
+			return nil, fmt.Errorf("%w: HMAC tokens not accepted", ErrUnknownToken)
+		}
+		return v.hmacSecret, nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		if v.jwks == nil {
+			return nil, fmt.Errorf("%w: no JWKS configured", ErrUnknownToken)
+		}
+		kid, _ := token.Header["kid"].(string)
+		key, err := v.jwks.Key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("key %q is not an RSA key", kid)
+			}
+		case *ecdsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+				return nil, fmt.Errorf("key %q is not an EC key", kid)
+			}
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing method %s", token.Method.Alg())
+	}
+}
+
+func (v *JWTValidator) Principal(claims jwt.MapClaims) (*models.Principal, error) {
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+
+	principal := &models.Principal{
+		ID:                 subject,
+		Type:               "jwt",
+		Name:               subject,
+		RateLimitPerMinute: v.cfg.RateLimitPerMinute,
+		RateLimitPerHour:   v.cfg.RateLimitPerHour,
+	}
+
+	if name, ok := claims[v.cfg.NameClaim].(string); ok && name != "" {
+		principal.Name = name
+	}
+	if tenant, ok := claims[v.cfg.TenantClaim].(string); ok {
+		principal.Tenant = tenant
+	}
+
+	switch scope := claims["scope"].(type) {
+	case string:
+		principal.Scopes = strings.Fields(scope)
+	case []interface{}:
+		principal.Scopes = stringSlice(scope)
+	}
+	if scp, ok := claims["scp"].([]interface{}); ok && len(principal.Scopes) == 0 {
+		principal.Scopes = stringSlice(scp)
+	}
+
+	if limit, ok := claims["rate_limit_per_minute"].(float64); ok && limit > 0 {
+		principal.RateLimitPerMinute = int(limit)
+	}
+	if limit, ok := claims["rate_limit_per_hour"].(float64); ok && limit > 0 {
+		principal.RateLimitPerHour = int(limit)
+	}
+	if limit, ok := claims["max_body_bytes"].(float64); ok && limit > 0 {
+		principal.MaxBodyBytes = int64(limit)
+	}
+
+	return principal, nil
+}
+
+func stringSlice(values []interface{}) []string {
+	var result []string
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
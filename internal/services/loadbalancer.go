@@ -0,0 +1,257 @@
+package services
+
+import (
+	"crypto/tls"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"api-gateway/internal/config"
+)
+
+const hashRingReplicas = 100
+
+type Target struct {
+	URL    *url.URL
+	Weight int
+
+	active int64
+	health targetHealth
+}
+
+func (t *Target) ActiveRequests() int64 {
+	return atomic.LoadInt64(&t.active)
+}
+
+func (t *Target) acquire() func() {
+	atomic.AddInt64(&t.active, 1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { atomic.AddInt64(&t.active, -1) })
+	}
+}
+
+type Balancer interface {
+	Pick(candidates []*Target, key string) *Target
+}
+
+type Upstream struct {
+	Name     string
+	HashOn   string
+	Protocol string
+	Targets  []*Target
+
+	balancer    Balancer
+	healthCheck *config.HealthCheckConfig
+	outlier     *config.OutlierDetectionConfig
+	breaker     *CircuitBreaker
+	tlsConfig   *tls.Config
+}
+
+func NewUpstream(cfg config.UpstreamConfig) (*Upstream, error) {
+	upstream := &Upstream{
+		Name:        cfg.Name,
+		HashOn:      cfg.HashOn,
+		Protocol:    cfg.Protocol,
+		healthCheck: newHealthCheckConfig(cfg.HealthCheck),
+		outlier:     cfg.OutlierDetection,
+	}
+	if cfg.CircuitBreaker != nil {
+		upstream.breaker = NewCircuitBreaker(cfg.Name, *cfg.CircuitBreaker)
+	}
+
+	switch cfg.Protocol {
+	case "", ProtocolH2C, ProtocolH2:
+	default:
+		return nil, fmt.Errorf("upstream %s: unknown protocol %q", cfg.Name, cfg.Protocol)
+	}
+
+	if cfg.TLS != nil {
+		if cfg.Protocol == ProtocolH2C {
+			return nil, fmt.Errorf("upstream %s: tls can't be used with protocol h2c", cfg.Name)
+		}
+		tlsConfig, err := newUpstreamTLSConfig(*cfg.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("upstream %s: %w", cfg.Name, err)
+		}
+		upstream.tlsConfig = tlsConfig
+	}
+
+	for _, tc := range cfg.Targets {
+		targetURL, err := url.Parse(tc.URL)
+		if err != nil || targetURL.Host == "" {
+			return nil, fmt.Errorf("upstream %s: invalid target %q", cfg.Name, tc.URL)
+		}
+		weight := tc.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		if cfg.Protocol == ProtocolH2C && targetURL.Scheme != "http" || cfg.Protocol == ProtocolH2 && targetURL.Scheme != "https" {
+			return nil, fmt.Errorf("upstream %s: protocol %s doesn't support target %q", cfg.Name, cfg.Protocol, tc.URL)
+		}
+		if cfg.TLS != nil && targetURL.Scheme != "https" {
+			return nil, fmt.Errorf("upstream %s: tls needs an https target, got %q", cfg.Name, tc.URL)
+		}
+		upstream.Targets = append(upstream.Targets, &Target{URL: targetURL, Weight: weight})
+	}
+
+	switch cfg.Strategy {
+	case "", "round_robin":
+		upstream.balancer = &roundRobinBalancer{}
+	case "weighted_round_robin":
+		upstream.balancer = newWeightedRoundRobinBalancer()
+	case "least_connections":
+		upstream.balancer = &leastConnectionsBalancer{}
+	case "random_two_choices":
+		upstream.balancer = &twoChoicesBalancer{}
+	case "consistent_hash":
+		upstream.balancer = newConsistentHashBalancer(upstream.Targets)
+	default:
+		return nil, fmt.Errorf("upstream %s: unknown strategy %q", cfg.Name, cfg.Strategy)
+	}
+
+	return upstream, nil
+}
+
+func (u *Upstream) CircuitBreaker() *CircuitBreaker {
+	return u.breaker
+}
+
+func (u *Upstream) Pick(key string, exclude map[*Target]bool) *Target {
+	candidates := make([]*Target, 0, len(u.Targets))
+	for _, target := range u.Targets {
+		if !exclude[target] && target.Available() {
+			candidates = append(candidates, target)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, target := range u.Targets {
+			if !exclude[target] {
+				candidates = append(candidates, target)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = u.Targets
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	return u.balancer.Pick(candidates, key)
+}
+
+type roundRobinBalancer struct {
+	next uint64
+}
+
+func (b *roundRobinBalancer) Pick(candidates []*Target, _ string) *Target {
+	n := atomic.AddUint64(&b.next, 1) - 1
+	return candidates[n%uint64(len(candidates))]
+}
+
+type weightedRoundRobinBalancer struct {
+	mu      sync.Mutex
+	current map[*Target]int
+}
+
+func newWeightedRoundRobinBalancer() *weightedRoundRobinBalancer {
+	return &weightedRoundRobinBalancer{current: make(map[*Target]int)}
+}
+
+func (b *weightedRoundRobinBalancer) Pick(candidates []*Target, _ string) *Target {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var best *Target
+	total := 0
+	for _, target := range candidates {
+		b.current[target] += target.Weight
+		total += target.Weight
+		if best == nil || b.current[target] > b.current[best] {
+			best = target
+		}
+	}
+	b.current[best] -= total
+	return best
+}
+
+type leastConnectionsBalancer struct {
+	next uint64
+}
+
+func (b *leastConnectionsBalancer) Pick(candidates []*Target, _ string) *Target {
+	offset := int(atomic.AddUint64(&b.next, 1) % uint64(len(candidates)))
+
+	var best *Target
+	for i := range candidates {
+		target := candidates[(offset+i)%len(candidates)]
+		if best == nil || target.ActiveRequests()*int64(best.Weight) < best.ActiveRequests()*int64(target.Weight) {
+			best = target
+		}
+	}
+	return best
+}
+
+type twoChoicesBalancer struct{}
+
+func (b *twoChoicesBalancer) Pick(candidates []*Target, _ string) *Target {
+	i := rand.Intn(len(candidates))
+	j := rand.Intn(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+
+	first, second := candidates[i], candidates[j]
+	if second.ActiveRequests()*int64(first.Weight) < first.ActiveRequests()*int64(second.Weight) {
+		return second
+	}
+	return first
+}
+
+type consistentHashBalancer struct {
+	hashes []uint32
+	owners map[uint32]*Target
+}
+
+func newConsistentHashBalancer(targets []*Target) *consistentHashBalancer {
+	b := &consistentHashBalancer{owners: make(map[uint32]*Target)}
+	for _, target := range targets {
+		for i := 0; i < hashRingReplicas*target.Weight; i++ {
+			hash := crc32.ChecksumIEEE([]byte(target.URL.String() + "#" + strconv.Itoa(i)))
+			if _, taken := b.owners[hash]; taken {
+				continue
+			}
+			b.owners[hash] = target
+			b.hashes = append(b.hashes, hash)
+		}
+	}
+	sort.Slice(b.hashes, func(i, j int) bool { return b.hashes[i] < b.hashes[j] })
+	return b
+}
+
+func (b *consistentHashBalancer) Pick(candidates []*Target, key string) *Target {
+	if key == "" {
+		return candidates[rand.Intn(len(candidates))]
+	}
+
+	allowed := make(map[*Target]bool, len(candidates))
+	for _, target := range candidates {
+		allowed[target] = true
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(b.hashes), func(i int) bool { return b.hashes[i] >= hash })
+	for i := 0; i < len(b.hashes); i++ {
+		owner := b.owners[b.hashes[(start+i)%len(b.hashes)]]
+		if allowed[owner] {
+			return owner
+		}
+	}
+	return candidates[0]
+}
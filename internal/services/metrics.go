@@ -14,6 +14,18 @@ type MetricsCollector struct {
 	cacheHits        int64
 	cacheMisses      int64
 	rateLimitHits    int64
+	upstreamErrors   int64
+	upstreamTimeouts int64
+	hedgesFired      int64
+	hedgesWon        int64
+
+	webSocketsActive      int64
+	webSocketsOpened      int64
+	webSocketsRejected    int64
+	webSocketMessages     int64
+	webSocketIdleTimeouts int64
+
+	grpcStatuses map[string]int64
 
 	totalResponseTime int64
 
@@ -22,7 +34,8 @@ type MetricsCollector struct {
 
 func NewMetricsCollector() *MetricsCollector {
 	return &MetricsCollector{
-		startTime: time.Now(),
+		grpcStatuses: make(map[string]int64),
+		startTime:    time.Now(),
 	}
 }
 
@@ -33,7 +46,7 @@ func (mc *MetricsCollector) RecordRequest(responseTimeMs int, statusCode int) {
 	mc.totalRequests++
 	mc.totalResponseTime += int64(responseTimeMs)
 
-	if statusCode >= 200 && statusCode < 400 {
+	if statusCode >= 100 && statusCode < 400 {
 		mc.successRequests++
 	} else {
 		mc.errorRequests++
@@ -58,6 +71,67 @@ func (mc *MetricsCollector) RecordRateLimitHit() {
 	mc.rateLimitHits++
 }
 
+func (mc *MetricsCollector) RecordUpstreamError() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.upstreamErrors++
+}
+
+func (mc *MetricsCollector) RecordUpstreamTimeout() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.upstreamTimeouts++
+}
+
+func (mc *MetricsCollector) RecordHedgeFired() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.hedgesFired++
+}
+
+func (mc *MetricsCollector) RecordHedgeWon() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.hedgesWon++
+}
+
+func (mc *MetricsCollector) RecordWebSocketOpen() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.webSocketsActive++
+	mc.webSocketsOpened++
+}
+
+func (mc *MetricsCollector) RecordWebSocketClose() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.webSocketsActive--
+}
+
+func (mc *MetricsCollector) RecordWebSocketRejected() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.webSocketsRejected++
+}
+
+func (mc *MetricsCollector) RecordWebSocketMessage() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.webSocketMessages++
+}
+
+func (mc *MetricsCollector) RecordWebSocketIdleTimeout() {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.webSocketIdleTimeouts++
+}
+
+func (mc *MetricsCollector) RecordGRPCStatus(code string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.grpcStatuses[code]++
+}
+
 type MetricsSnapshot struct {
 	UptimeSeconds       int64   `json:"uptime_seconds"`
 	TotalRequests       int64   `json:"total_requests"`
@@ -66,7 +140,19 @@ type MetricsSnapshot struct {
 	ErrorRate           float64 `json:"error_rate"`
 	CacheHitRate        float64 `json:"cache_hit_rate"`
 	RateLimitHits       int64   `json:"rate_limit_hits"`
+	UpstreamErrors      int64   `json:"upstream_errors"`
+	UpstreamTimeouts    int64   `json:"upstream_timeouts"`
+	HedgesFired         int64   `json:"hedges_fired"`
+	HedgesWon           int64   `json:"hedges_won"`
+	WebSocketsActive    int64   `json:"websockets_active"`
+	WebSocketsOpened    int64   `json:"websockets_opened"`
+	WebSocketsRejected  int64   `json:"websockets_rejected"`
+	WebSocketMessages   int64   `json:"websocket_messages"`
+	WebSocketIdleClosed int64   `json:"websocket_idle_closed"`
 	Timestamp           string  `json:"timestamp"`
+
+	GRPCStatuses    map[string]int64                `json:"grpc_statuses,omitempty"`
+	CircuitBreakers map[string]CircuitBreakerStatus `json:"circuit_breakers,omitempty"`
 }
 
 func (mc *MetricsCollector) GetSnapshot() *MetricsSnapshot {
@@ -77,10 +163,26 @@ func (mc *MetricsCollector) GetSnapshot() *MetricsSnapshot {
 	uptimeSeconds := int64(uptime.Seconds())
 
 	snapshot := &MetricsSnapshot{
-		UptimeSeconds:     uptimeSeconds,
-		TotalRequests:     mc.totalRequests,
-		RateLimitHits:     mc.rateLimitHits,
-		Timestamp:         time.Now().Format(time.RFC3339),
+		UptimeSeconds:       uptimeSeconds,
+		TotalRequests:       mc.totalRequests,
+		RateLimitHits:       mc.rateLimitHits,
+		UpstreamErrors:      mc.upstreamErrors,
+		UpstreamTimeouts:    mc.upstreamTimeouts,
+		HedgesFired:         mc.hedgesFired,
+		HedgesWon:           mc.hedgesWon,
+		WebSocketsActive:    mc.webSocketsActive,
+		WebSocketsOpened:    mc.webSocketsOpened,
+		WebSocketsRejected:  mc.webSocketsRejected,
+		WebSocketMessages:   mc.webSocketMessages,
+		WebSocketIdleClosed: mc.webSocketIdleTimeouts,
+		Timestamp:           time.Now().Format(time.RFC3339),
+	}
+
+	if len(mc.grpcStatuses) > 0 {
+		snapshot.GRPCStatuses = make(map[string]int64, len(mc.grpcStatuses))
+		for code, count := range mc.grpcStatuses {
+			snapshot.GRPCStatuses[code] = count
+		}
 	}
 
 	if uptimeSeconds > 0 {
@@ -113,6 +215,15 @@ func (mc *MetricsCollector) Reset() {
 	mc.cacheHits = 0
 	mc.cacheMisses = 0
 	mc.rateLimitHits = 0
+	mc.upstreamErrors = 0
+	mc.upstreamTimeouts = 0
+	mc.hedgesFired = 0
+	mc.hedgesWon = 0
+	mc.webSocketsOpened = 0
+	mc.webSocketsRejected = 0
+	mc.webSocketMessages = 0
+	mc.webSocketIdleTimeouts = 0
+	mc.grpcStatuses = make(map[string]int64)
 	mc.totalResponseTime = 0
 	mc.startTime = time.Now()
 }
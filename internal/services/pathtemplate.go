@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	segmentLiteral = iota
+	segmentSingle
+	segmentMulti
+)
+
+// pathTemplate is a google.api.http style path template such as
+// /v1/{name=shelves/*/books/*}:publish.
+type pathTemplate struct {
+	segments  []templateSegment
+	variables []templateVariable
+	verb      string
+}
+
+type templateSegment struct {
+	kind    int
+	literal string
+}
+
+type templateVariable struct {
+	field      string
+	start, end int
+}
+
+func parsePathTemplate(tmpl string) (*pathTemplate, error) {
+	if !strings.HasPrefix(tmpl, "/") {
+		return nil, fmt.Errorf("path template %q must start with /", tmpl)
+	}
+
+	pt := &pathTemplate{}
+	rest := tmpl[1:]
+	if i := strings.LastIndexByte(rest, ':'); i >= 0 && i > strings.LastIndexAny(rest, "/}") {
+		pt.verb = rest[i+1:]
+		rest = rest[:i]
+	}
+
+	for rest != "" {
+		if rest[0] == '{' {
+			end := strings.IndexByte(rest, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("path template %q has an unclosed variable", tmpl)
+			}
+			field, pattern, ok := strings.Cut(rest[1:end], "=")
+			if !ok {
+				pattern = "*"
+			}
+			if field == "" {
+				return nil, fmt.Errorf("path template %q has an unnamed variable", tmpl)
+			}
+			variable := templateVariable{field: field, start: len(pt.segments)}
+			for _, part := range strings.Split(pattern, "/") {
+				pt.segments = append(pt.segments, newTemplateSegment(part))
+			}
+			variable.end = len(pt.segments)
+			pt.variables = append(pt.variables, variable)
+			rest = rest[end+1:]
+		} else {
+			end := strings.IndexByte(rest, '/')
+			if end < 0 {
+				end = len(rest)
+			}
+			pt.segments = append(pt.segments, newTemplateSegment(rest[:end]))
+			rest = rest[end:]
+		}
+
+		if rest == "" {
+			break
+		}
+		if rest[0] != '/' {
+			return nil, fmt.Errorf("path template %q is malformed", tmpl)
+		}
+		rest = rest[1:]
+	}
+
+	return pt, nil
+}
+
+func newTemplateSegment(part string) templateSegment {
+	switch part {
+	case "*":
+		return templateSegment{kind: segmentSingle}
+	case "**":
+		return templateSegment{kind: segmentMulti}
+	default:
+		return templateSegment{kind: segmentLiteral, literal: part}
+	}
+}
+
+func (pt *pathTemplate) literals() int {
+	n := 0
+	for _, segment := range pt.segments {
+		if segment.kind == segmentLiteral {
+			n++
+		}
+	}
+	return n
+}
+
+func (pt *pathTemplate) match(path string) (map[string]string, bool) {
+	vars, ok := pt.matchEscaped(path)
+	for field, value := range vars {
+		segments := strings.Split(value, "/")
+		for i, segment := range segments {
+			if unescaped, err := url.PathUnescape(segment); err == nil {
+				segments[i] = unescaped
+			}
+		}
+		vars[field] = strings.Join(segments, "/")
+	}
+	return vars, ok
+}
+
+// matchEscaped matches an escaped path and returns the variables still
+// escaped, so an encoded "/" inside a segment stays encoded.
+func (pt *pathTemplate) matchEscaped(path string) (map[string]string, bool) {
+	if pt.verb != "" {
+		if !strings.HasSuffix(path, ":"+pt.verb) {
+			return nil, false
+		}
+		path = strings.TrimSuffix(path, ":"+pt.verb)
+	}
+
+	var parts []string
+	if trimmed := strings.TrimPrefix(path, "/"); trimmed != "" {
+		parts = strings.Split(trimmed, "/")
+	}
+
+	bounds := make([]int, len(pt.segments)+1)
+	idx := 0
+	for i, segment := range pt.segments {
+		bounds[i] = idx
+		if segment.kind == segmentMulti {
+			n := len(parts) - idx - (len(pt.segments) - i - 1)
+			if n < 0 {
+				return nil, false
+			}
+			idx += n
+			continue
+		}
+		if idx >= len(parts) || segment.kind == segmentLiteral && parts[idx] != segment.literal {
+			return nil, false
+		}
+		idx++
+	}
+	bounds[len(pt.segments)] = idx
+	if idx != len(parts) {
+		return nil, false
+	}
+
+	vars := make(map[string]string, len(pt.variables))
+	for _, variable := range pt.variables {
+		vars[variable.field] = strings.Join(parts[bounds[variable.start]:bounds[variable.end]], "/")
+	}
+	return vars, true
+}
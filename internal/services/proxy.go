@@ -1,63 +1,722 @@
 package services
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/models"
 )
 
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+var ErrUpstreamTimeout = errors.New("upstream timeout")
+
+// ErrRequestBody means the client's upload failed while it was being sent
+// upstream, so the upstream isn't to blame.
+var ErrRequestBody = errors.New("couldn't read request body")
+
+type RequestError struct {
+	Status  int
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
 type ProxyService struct {
-	backendURL string
-	client     *http.Client
+	upstreams map[string]*Upstream
+	identity  *IdentityHeaders
+	timeouts  config.TimeoutConfig
+	metrics   *MetricsCollector
+
+	mu             sync.Mutex
+	clients        map[clientKey]*http.Client
+	retryPolicies  map[*config.RouteConfig]*RetryPolicy
+	hedgePolicies  map[*config.RouteConfig]*HedgePolicy
+	transcoders    map[*config.TranscodeConfig]*Transcoder
+	rewriters      map[*config.RewriteConfig]*Rewriter
+	headers        map[*config.HeaderRulesConfig]*HeaderPolicy
+	bodyTransforms map[*config.BodyTransformConfig]*BodyTransform
 }
 
-func NewProxyService(backendURL string) *ProxyService {
+func NewProxyService(upstreamConfigs []config.UpstreamConfig, identity *IdentityHeaders, timeouts config.TimeoutConfig, metrics *MetricsCollector) (*ProxyService, error) {
+	upstreams := make(map[string]*Upstream)
+	for _, uc := range upstreamConfigs {
+		upstream, err := NewUpstream(uc)
+		if err != nil {
+			return nil, err
+		}
+		upstreams[uc.Name] = upstream
+	}
+
 	return &ProxyService{
-		backendURL: backendURL,
-		client:     &http.Client{},
+		upstreams:      upstreams,
+		identity:       identity,
+		timeouts:       timeouts,
+		clients:        make(map[clientKey]*http.Client),
+		retryPolicies:  make(map[*config.RouteConfig]*RetryPolicy),
+		hedgePolicies:  make(map[*config.RouteConfig]*HedgePolicy),
+		transcoders:    make(map[*config.TranscodeConfig]*Transcoder),
+		rewriters:      make(map[*config.RewriteConfig]*Rewriter),
+		headers:        make(map[*config.HeaderRulesConfig]*HeaderPolicy),
+		bodyTransforms: make(map[*config.BodyTransformConfig]*BodyTransform),
+		metrics:        metrics,
+	}, nil
+}
+
+type clientKey struct {
+	protocol  string
+	timeouts  config.TimeoutConfig
+	tlsConfig *tls.Config
+}
+
+func (p *ProxyService) clientFor(upstream *Upstream, timeouts config.TimeoutConfig) *http.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := clientKey{protocol: upstream.Protocol, timeouts: timeouts, tlsConfig: upstream.tlsConfig}
+	if client, ok := p.clients[key]; ok {
+		return client
+	}
+
+	client := &http.Client{
+		Transport: newTransport(upstream.Protocol, timeouts, upstream.tlsConfig),
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	p.clients[key] = client
+	return client
+}
+
+func (p *ProxyService) LoadRoutes(routes []config.RouteConfig) error {
+	for _, route := range routes {
+		if route.Transcode != nil {
+			transcoder, err := NewTranscoder(*route.Transcode)
+			if err != nil {
+				return fmt.Errorf("route %s: %w", route.Name, err)
+			}
+			p.transcoders[route.Transcode] = transcoder
+		}
+		if route.Rewrite != nil {
+			rewriter, err := NewRewriter(route)
+			if err != nil {
+				return fmt.Errorf("route %s: %w", route.Name, err)
+			}
+			p.rewriters[route.Rewrite] = rewriter
+		}
+		if route.Headers != nil {
+			for _, rules := range []*config.HeaderRulesConfig{route.Headers.Request, route.Headers.Response} {
+				if rules == nil {
+					continue
+				}
+				policy, err := NewHeaderPolicy(rules)
+				if err != nil {
+					return fmt.Errorf("route %s: %w", route.Name, err)
+				}
+				p.headers[rules] = policy
+			}
+		}
+		if route.Body != nil {
+			for _, cfg := range []*config.BodyTransformConfig{route.Body.Request, route.Body.Response} {
+				if cfg == nil {
+					continue
+				}
+				transform, err := NewBodyTransform(cfg)
+				if err != nil {
+					return fmt.Errorf("route %s: %w", route.Name, err)
+				}
+				p.bodyTransforms[cfg] = transform
+			}
+		}
+	}
+	return nil
+}
+
+func (p *ProxyService) headerPolicy(route *config.RouteConfig, response bool) *HeaderPolicy {
+	if route == nil || route.Headers == nil {
+		return nil
+	}
+	if response {
+		return p.headers[route.Headers.Response]
+	}
+	return p.headers[route.Headers.Request]
+}
+
+func (p *ProxyService) ApplyResponseHeaders(resp *http.Response, r *http.Request, route *config.RouteConfig, principal *models.Principal) {
+	if policy := p.headerPolicy(route, true); policy != nil {
+		policy.Apply(resp.Header, templateContext{r: r, route: route, principal: principal})
+	}
+}
+
+func (p *ProxyService) Upstreams() map[string]*Upstream {
+	return p.upstreams
+}
+
+func (p *ProxyService) CircuitBreakerStatus() map[string]CircuitBreakerStatus {
+	statuses := make(map[string]CircuitBreakerStatus)
+	for name, upstream := range p.upstreams {
+		if upstream.breaker != nil {
+			statuses[name] = upstream.breaker.Status()
+		}
+	}
+	return statuses
+}
+
+func (p *ProxyService) retryPolicy(route *config.RouteConfig) *RetryPolicy {
+	if route == nil || route.Retry == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	policy, ok := p.retryPolicies[route]
+	if !ok {
+		policy = NewRetryPolicy(*route.Retry)
+		p.retryPolicies[route] = policy
+	}
+	return policy
+}
+
+func (p *ProxyService) hedgePolicy(route *config.RouteConfig) *HedgePolicy {
+	if route == nil || route.Hedge == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	policy, ok := p.hedgePolicies[route]
+	if !ok {
+		policy = NewHedgePolicy(*route.Hedge)
+		p.hedgePolicies[route] = policy
 	}
+	return policy
 }
 
-func (p *ProxyService) ForwardRequest(r *http.Request) (*http.Response, error) {
-	targetURL, err := url.Parse(p.backendURL)
+func (p *ProxyService) ForwardRequest(r *http.Request, route *config.RouteConfig, principal *models.Principal) (*http.Response, error) {
+	upstreamName := config.DefaultUpstream
+	if route != nil && route.Upstream != "" {
+		upstreamName = route.Upstream
+	}
+	upstream, ok := p.upstreams[upstreamName]
+	if !ok {
+		return nil, fmt.Errorf("unknown upstream %s", upstreamName)
+	}
+
+	timeouts := p.timeouts
+	if route != nil {
+		timeouts = timeouts.Merge(route.Timeouts)
+		if rewriter := p.rewriters[route.Rewrite]; rewriter != nil && route.Transcode == nil {
+			r = rewriter.Apply(r)
+		}
+		if route.Transcode == nil {
+			var err error
+			if r, err = p.transformRequest(r, route); err != nil {
+				return nil, err
+			}
+		}
+	}
+	client := p.clientFor(upstream, timeouts)
+
+	upgrade := IsWebSocketUpgrade(r)
+
+	// gRPC streams can stay open indefinitely, so they only get the deadline
+	// the client asked for, which holds for the whole call.
+	total := time.Duration(timeouts.TotalMs) * time.Millisecond
+	isGRPC := IsGRPCRequest(r) && (route == nil || route.Transcode == nil)
+	if isGRPC {
+		total, _ = GRPCTimeout(r.Header)
+	}
+
+	ctx, cancel := r.Context(), context.CancelFunc(func() {})
+	var deadline *liftableDeadline
+	if total > 0 && !upgrade {
+		deadline = withLiftableDeadline(ctx, total)
+		ctx, cancel = deadline, deadline.Release
+	}
+
+	policy := p.retryPolicy(route)
+	body := streamingBody(r)
+	if policy.AppliesTo(r.Method) && !upgrade {
+		policy.budget.RecordRequest()
+		var err error
+		if body, err = newReplayableBody(r, policy.maxBodyBytes); err != nil {
+			cancel()
+			return nil, err
+		}
+	} else {
+		policy = nil
+	}
+
+	hedge := p.hedgePolicy(route)
+	if !hedge.AppliesTo(r.Method) || !body.Replayable() || upgrade {
+		hedge = nil
+	}
+
+	tried := make(map[*Target]bool)
+	for attempt := 1; ; attempt++ {
+		var resp *http.Response
+		var target *Target
+		var err error
+		if hedge != nil {
+			resp, target, err = p.hedgedAttempt(ctx, client, r, route, upstream, principal, body, tried, hedge)
+		} else {
+			target = upstream.Pick(hashKey(upstream.HashOn, r, principal), tried)
+			resp, err = p.attempt(ctx, client, r, route, upstream, principal, body, target)
+		}
+
+		retry := policy != nil &&
+			body.Replayable() &&
+			r.Context().Err() == nil &&
+			policy.ShouldRetry(attempt, resp, err) &&
+			policy.budget.TryRetry()
+
+		if !retry {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			if deadline != nil && !isGRPC && IsStreamingResponse(resp.Header) {
+				deadline.Lift()
+			}
+			resp.Body = &releasingBody{ReadCloser: resp.Body, release: cancel}
+			return resp, nil
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		if target != nil {
+			tried[target] = true
+		}
+
+		if err := policy.Wait(ctx, attempt); err != nil {
+			cancel()
+			return nil, fmt.Errorf("%w: retry backoff: %v", ErrUpstreamTimeout, err)
+		}
+	}
+}
+
+func (p *ProxyService) attempt(ctx context.Context, client *http.Client, r *http.Request, route *config.RouteConfig, upstream *Upstream, principal *models.Principal, body *replayableBody, target *Target) (*http.Response, error) {
+	var call *CircuitCall
+	if upstream.breaker != nil {
+		var err error
+		if call, err = upstream.breaker.Allow(); err != nil {
+			return nil, err
+		}
+	}
+
+	release := target.acquire()
+
+	start := time.Now()
+	resp, err := p.send(ctx, client, r, route, target, principal, body)
 	if err != nil {
+		release()
+		if errors.Is(ctx.Err(), context.Canceled) || errors.Is(err, ErrRequestBody) {
+			call.Abandon()
+			return nil, err
+		}
+		upstream.ReportResult(target, true)
+		call.Done(true, time.Since(start))
+		if isTimeout(err) {
+			return nil, fmt.Errorf("%w: %v", ErrUpstreamTimeout, err)
+		}
 		return nil, err
 	}
+	upstream.ReportResult(target, resp.StatusCode >= 500)
+	call.Done(resp.StatusCode >= 500, time.Since(start))
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+func (p *ProxyService) send(ctx context.Context, client *http.Client, r *http.Request, route *config.RouteConfig, target *Target, principal *models.Principal, body *replayableBody) (*http.Response, error) {
+	targetURL := *target.URL
 
-	targetURL.Path = strings.TrimSuffix(targetURL.Path, "/") + r.URL.Path
+	targetURL.Path, targetURL.RawPath = joinURLPath(&targetURL, r.URL)
 	targetURL.RawQuery = r.URL.RawQuery
 
-	proxyReq, err := http.NewRequest(r.Method, targetURL.String(), r.Body)
+	reqBody, contentLength := body.Reader()
+	var tracked *trackingBody
+	if reqBody != nil {
+		tracked = &trackingBody{ReadCloser: reqBody}
+		reqBody = tracked
+	}
+
+	proxyReq, err := http.NewRequestWithContext(ctx, r.Method, targetURL.String(), reqBody)
 	if err != nil {
 		return nil, err
 	}
+	proxyReq.ContentLength = contentLength
 
-	for key, values := range r.Header {
-		for _, value := range values {
-			proxyReq.Header.Add(key, value)
-		}
+	proxyReq.Header = r.Header.Clone()
+	removeHopByHopHeaders(proxyReq.Header)
+	if IsWebSocketUpgrade(r) {
+		proxyReq.Header.Set("Connection", "Upgrade")
+		proxyReq.Header.Set("Upgrade", "websocket")
+	}
+	if acceptsTrailers(r.Header) {
+		proxyReq.Header.Set("Te", "trailers")
+	}
+	if _, ok := proxyReq.Header["User-Agent"]; !ok {
+		proxyReq.Header.Set("User-Agent", "")
 	}
+	setForwardedHeaders(proxyReq, r)
 
 	proxyReq.Host = targetURL.Host
 
-	resp, err := p.client.Do(proxyReq)
+	if err := p.identity.Apply(proxyReq, principal); err != nil {
+		return nil, err
+	}
+	if policy := p.headerPolicy(route, false); policy != nil {
+		policy.Apply(proxyReq.Header, templateContext{r: r, route: route, principal: principal})
+	}
+	if p.bodyTransform(route, true) != nil {
+		proxyReq.Header.Del("Accept-Encoding")
+	}
+
+	resp, err := client.Do(proxyReq)
 	if err != nil {
+		if readErr := tracked.Err(); readErr != nil {
+			return nil, fmt.Errorf("%w: %w", ErrRequestBody, readErr)
+		}
 		return nil, err
 	}
 
 	return resp, nil
 }
 
-func (p *ProxyService) CopyResponse(w http.ResponseWriter, resp *http.Response) error {
+// trackingBody remembers why reading the client's body failed, since the
+// transport only reports that the request couldn't be written.
+type trackingBody struct {
+	io.ReadCloser
+
+	mu  sync.Mutex
+	err error
+}
+
+func (b *trackingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		b.mu.Lock()
+		b.err = err
+		b.mu.Unlock()
+	}
+	return n, err
+}
+
+func (b *trackingBody) Err() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+func (p *ProxyService) CopyResponse(w http.ResponseWriter, resp *http.Response, flushInterval time.Duration) error {
+	removeHopByHopHeaders(resp.Header)
+
 	for key, values := range resp.Header {
 		for _, value := range values {
 			w.Header().Add(key, value)
 		}
 	}
 
+	announcedTrailers := len(resp.Trailer)
+	if announcedTrailers > 0 {
+		keys := make([]string, 0, announcedTrailers)
+		for key := range resp.Trailer {
+			keys = append(keys, key)
+		}
+		w.Header().Add("Trailer", strings.Join(keys, ", "))
+	}
+
+	rc := http.NewResponseController(w)
+	if IsStreamingResponse(resp.Header) {
+		flushInterval = -1
+		rc.SetWriteDeadline(time.Time{})
+	} else if resp.ContentLength == -1 {
+		flushInterval = -1
+	}
+
 	w.WriteHeader(resp.StatusCode)
 
-	_, err := io.Copy(w, resp.Body)
+	var err error
+	if flushInterval == 0 {
+		_, err = io.Copy(w, resp.Body)
+	} else if err = rc.Flush(); err == nil || errors.Is(err, http.ErrNotSupported) {
+		err = copyWithFlush(w, rc, resp.Body, flushInterval)
+	}
+	if err != nil {
+		return err
+	}
+
+	copyTrailers(w.Header(), resp.Trailer, announcedTrailers)
+	return nil
+}
+
+func copyTrailers(dst, trailer http.Header, announced int) {
+	for key, values := range trailer {
+		if len(trailer) != announced {
+			key = http.TrailerPrefix + key
+		}
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+}
+
+func copyWithFlush(w io.Writer, rc *http.ResponseController, body io.Reader, flushInterval time.Duration) error {
+	fw := &flushWriter{w: w, rc: rc, interval: flushInterval}
+	defer fw.stop()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			if _, err := fw.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			fw.flush()
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// flushWriter flushes after every write when interval is negative, and
+// otherwise at most interval after data was written, from a timer, so a
+// partial chunk doesn't wait for the upstream's next write.
+type flushWriter struct {
+	w        io.Writer
+	rc       *http.ResponseController
+	interval time.Duration
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	pending bool
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	n, err := fw.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if fw.interval < 0 {
+		if err := fw.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return n, err
+		}
+		return n, nil
+	}
+
+	if !fw.pending {
+		fw.pending = true
+		if fw.timer == nil {
+			fw.timer = time.AfterFunc(fw.interval, fw.flush)
+		} else {
+			fw.timer.Reset(fw.interval)
+		}
+	}
+	return n, nil
+}
+
+func (fw *flushWriter) flush() {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	fw.pending = false
+	fw.rc.Flush()
+}
+
+func (fw *flushWriter) stop() {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	fw.pending = false
+	if fw.timer != nil {
+		fw.timer.Stop()
+	}
+}
+
+var streamingContentTypes = []string{
+	"text/event-stream",
+	"application/x-ndjson",
+	"multipart/x-mixed-replace",
+	"application/grpc",
+}
+
+func IsStreamingResponse(header http.Header) bool {
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	for _, streaming := range streamingContentTypes {
+		if strings.HasPrefix(contentType, streaming) {
+			return true
+		}
+	}
+	return false
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Write(p []byte) (int, error) {
+	w, ok := b.ReadCloser.(io.Writer)
+	if !ok {
+		return 0, http.ErrNotSupported
+	}
+	return w.Write(p)
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
 	return err
 }
+
+func hashKey(hashOn string, r *http.Request, principal *models.Principal) string {
+	switch {
+	case strings.HasPrefix(hashOn, "header:"):
+		return r.Header.Get(strings.TrimPrefix(hashOn, "header:"))
+	case hashOn == "path":
+		return r.URL.Path
+	case hashOn == "client_ip":
+		return ClientIP(r)
+	case principal != nil:
+		return principal.Type + ":" + principal.ID
+	default:
+		return ""
+	}
+}
+
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func removeHopByHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = textproto.TrimString(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+}
+
+// forwardingHeaders are only passed on from trusted proxies. Anyone else
+// could use them to claim a different address.
+var forwardingHeaders = []string{
+	"X-Forwarded-For",
+	"X-Forwarded-Proto",
+	"X-Forwarded-Host",
+	"X-Real-IP",
+	"Forwarded",
+}
+
+func setForwardedHeaders(proxyReq, r *http.Request) {
+	if !fromTrustedProxy(r) {
+		for _, name := range forwardingHeaders {
+			proxyReq.Header.Del(name)
+		}
+	}
+
+	clientIP := ClientIP(r)
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	if prior := proxyReq.Header.Get("X-Forwarded-Proto"); prior != "" {
+		proto = prior
+	}
+	host := r.Host
+	if prior := proxyReq.Header.Get("X-Forwarded-Host"); prior != "" {
+		host = prior
+	}
+
+	// The client address has already been resolved through the trusted
+	// proxies, so the upstream gets it alone rather than the inbound chain.
+	proxyReq.Header.Set("X-Forwarded-For", clientIP)
+	proxyReq.Header.Set("X-Forwarded-Proto", proto)
+	proxyReq.Header.Set("X-Forwarded-Host", host)
+
+	forwardedFor := clientIP
+	if strings.Contains(clientIP, ":") {
+		forwardedFor = `"[` + clientIP + `]"`
+	}
+	proxyReq.Header.Set("Forwarded", "for="+forwardedFor+";proto="+proto+";host="+quoteForwarded(host))
+
+	proxyReq.Header.Set("Via", viaHeader(r))
+}
+
+func quoteForwarded(value string) string {
+	if strings.ContainsAny(value, ":[]\"") {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+	return value
+}
+
+func viaHeader(r *http.Request) string {
+	via := r.Header.Get("Via")
+	entry := "1.1 api-gateway"
+	if r.ProtoMajor == 2 {
+		entry = "2 api-gateway"
+	}
+	if via != "" {
+		return via + ", " + entry
+	}
+	return entry
+}
+
+func joinURLPath(base, request *url.URL) (path, rawPath string) {
+	basePath := strings.TrimSuffix(base.Path, "/")
+	baseRaw := strings.TrimSuffix(base.EscapedPath(), "/")
+
+	path = basePath + request.Path
+	rawPath = baseRaw + request.EscapedPath()
+	if rawPath == (&url.URL{Path: path}).EscapedPath() {
+		rawPath = ""
+	}
+	return path, rawPath
+}
@@ -0,0 +1,229 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+)
+
+const retryBudgetWindow = 10 * time.Second
+
+var defaultIdempotentMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodPut,
+	http.MethodDelete,
+}
+
+type RetryPolicy struct {
+	maxAttempts   int
+	methods       []string
+	statuses      map[int]bool
+	retryOnErrors bool
+	backoffBase   time.Duration
+	backoffMax    time.Duration
+	maxBodyBytes  int64
+	budget        *RetryBudget
+}
+
+func NewRetryPolicy(cfg config.RetryConfig) *RetryPolicy {
+	policy := &RetryPolicy{
+		maxAttempts:   cfg.MaxAttempts,
+		methods:       cfg.Methods,
+		statuses:      make(map[int]bool),
+		retryOnErrors: cfg.RetryOnErrors == nil || *cfg.RetryOnErrors,
+		backoffBase:   time.Duration(cfg.BackoffBaseMs) * time.Millisecond,
+		backoffMax:    time.Duration(cfg.BackoffMaxMs) * time.Millisecond,
+		maxBodyBytes:  cfg.MaxBodyBytes,
+		budget:        NewRetryBudget(cfg.BudgetPercent, cfg.BudgetMinPerSecond),
+	}
+
+	if len(policy.methods) == 0 {
+		policy.methods = defaultIdempotentMethods
+	}
+	statuses := cfg.RetryOnStatus
+	if len(statuses) == 0 {
+		statuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	for _, status := range statuses {
+		policy.statuses[status] = true
+	}
+	if policy.backoffBase <= 0 {
+		policy.backoffBase = 25 * time.Millisecond
+	}
+	if policy.backoffMax <= 0 {
+		policy.backoffMax = time.Second
+	}
+	if policy.maxBodyBytes <= 0 {
+		policy.maxBodyBytes = 1 << 20
+	}
+
+	return policy
+}
+
+func (rp *RetryPolicy) AppliesTo(method string) bool {
+	if rp == nil || rp.maxAttempts <= 1 {
+		return false
+	}
+	for _, m := range rp.methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rp *RetryPolicy) ShouldRetry(attempt int, resp *http.Response, err error) bool {
+	if attempt >= rp.maxAttempts {
+		return false
+	}
+
+	if err != nil {
+		if errors.Is(err, ErrCircuitOpen) {
+			return false
+		}
+		return rp.retryOnErrors
+	}
+
+	return rp.statuses[resp.StatusCode]
+}
+
+func (rp *RetryPolicy) Wait(ctx context.Context, attempt int) error {
+	ceiling := rp.backoffBase << (attempt - 1)
+	if ceiling > rp.backoffMax || ceiling <= 0 {
+		ceiling = rp.backoffMax
+	}
+	delay := time.Duration(rand.Int63n(int64(ceiling) + 1))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type RetryBudget struct {
+	ratio      float64
+	minRetries int
+
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    int
+	retries     int
+}
+
+func NewRetryBudget(percent float64, minPerSecond int) *RetryBudget {
+	if percent <= 0 {
+		percent = 20
+	}
+	if minPerSecond <= 0 {
+		minPerSecond = 3
+	}
+
+	return &RetryBudget{
+		ratio:       percent / 100,
+		minRetries:  minPerSecond * int(retryBudgetWindow/time.Second),
+		windowStart: time.Now(),
+	}
+}
+
+func (rb *RetryBudget) RecordRequest() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.roll()
+	rb.requests++
+}
+
+func (rb *RetryBudget) TryRetry() bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.roll()
+	allowed := int(float64(rb.requests) * rb.ratio)
+	if allowed < rb.minRetries {
+		allowed = rb.minRetries
+	}
+	if rb.retries >= allowed {
+		return false
+	}
+
+	rb.retries++
+	return true
+}
+
+func (rb *RetryBudget) roll() {
+	if time.Since(rb.windowStart) >= retryBudgetWindow {
+		rb.windowStart = time.Now()
+		rb.requests = 0
+		rb.retries = 0
+	}
+}
+
+type replayableBody struct {
+	data     []byte
+	stream   io.ReadCloser
+	length   int64
+	buffered bool
+}
+
+func newReplayableBody(r *http.Request, maxBytes int64) (*replayableBody, error) {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return &replayableBody{buffered: true}, nil
+	}
+
+	if r.ContentLength > maxBytes {
+		return &replayableBody{stream: r.Body, length: r.ContentLength}, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return &replayableBody{
+			stream: struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body},
+			length: r.ContentLength,
+		}, nil
+	}
+
+	r.Body.Close()
+	return &replayableBody{data: data, length: int64(len(data)), buffered: true}, nil
+}
+
+func streamingBody(r *http.Request) *replayableBody {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return &replayableBody{buffered: true}
+	}
+	return &replayableBody{stream: r.Body, length: r.ContentLength}
+}
+
+func (b *replayableBody) Reader() (io.ReadCloser, int64) {
+	if !b.buffered {
+		return b.stream, b.length
+	}
+	if len(b.data) == 0 {
+		return nil, 0
+	}
+	return io.NopCloser(bytes.NewReader(b.data)), b.length
+}
+
+func (b *replayableBody) Replayable() bool {
+	return b.buffered
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"api-gateway/internal/config"
+)
+
+var templateVariablePattern = regexp.MustCompile(`\{([^}=]+)(=[^}]*)?\}`)
+
+type Rewriter struct {
+	stripPrefix string
+	addPrefix   string
+	regexes     []regexRewrite
+	templates   []templateRewrite
+	query       *config.QueryRewriteConfig
+	renames     []queryRename
+}
+
+type queryRename struct {
+	from string
+	to   string
+}
+
+type regexRewrite struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+type templateRewrite struct {
+	from *pathTemplate
+	to   string
+}
+
+func NewRewriter(route config.RouteConfig) (*Rewriter, error) {
+	cfg := route.Rewrite
+	rw := &Rewriter{addPrefix: strings.TrimSuffix(escapePath(cfg.AddPrefix), "/"), query: cfg.Query}
+	if cfg.StripPrefix {
+		rw.stripPrefix = strings.TrimSuffix(escapePath(route.PathPrefix), "/")
+	}
+
+	for _, rc := range cfg.Regex {
+		pattern, err := regexp.Compile(rc.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rewrite regex %q: %w", rc.Pattern, err)
+		}
+		rw.regexes = append(rw.regexes, regexRewrite{pattern: pattern, replacement: rc.Replacement})
+	}
+
+	for _, tc := range cfg.Templates {
+		from, err := parsePathTemplate(tc.From)
+		if err != nil {
+			return nil, err
+		}
+		known := make(map[string]bool)
+		for _, variable := range from.variables {
+			known[variable.field] = true
+		}
+		for _, match := range templateVariablePattern.FindAllStringSubmatch(tc.To, -1) {
+			if !known[match[1]] {
+				return nil, fmt.Errorf("rewrite template %q uses {%s}, which %q doesn't capture", tc.To, match[1], tc.From)
+			}
+		}
+		rw.templates = append(rw.templates, templateRewrite{from: from, to: tc.To})
+	}
+
+	if cfg.Query != nil {
+		// Renames run sorted by source parameter so overlapping ones like a→b
+		// and b→c always give the same result.
+		sources := make([]string, 0, len(cfg.Query.Rename))
+		for from := range cfg.Query.Rename {
+			sources = append(sources, from)
+		}
+		sort.Strings(sources)
+		targets := make(map[string]string)
+		for _, from := range sources {
+			to := cfg.Query.Rename[from]
+			if other, ok := targets[to]; ok {
+				return nil, fmt.Errorf("rename of %q and %q both target %q", other, from, to)
+			}
+			targets[to] = from
+			rw.renames = append(rw.renames, queryRename{from: from, to: to})
+		}
+	}
+
+	return rw, nil
+}
+
+// Apply rewrites the escaped path, so encoded characters such as %2F stay
+// encoded instead of turning into real separators on the way upstream.
+func (rw *Rewriter) Apply(r *http.Request) *http.Request {
+	u := *r.URL
+	rawPath := rw.rewritePath(r.URL.EscapedPath())
+	if path, err := url.PathUnescape(rawPath); err == nil {
+		u.Path, u.RawPath = path, rawPath
+	} else {
+		u.Path, u.RawPath = rawPath, ""
+	}
+	if rw.query != nil {
+		u.RawQuery = rw.rewriteQuery(r.URL.Query()).Encode()
+	}
+
+	rewritten := new(http.Request)
+	*rewritten = *r
+	rewritten.URL = &u
+	return rewritten
+}
+
+func (rw *Rewriter) rewritePath(path string) string {
+	if rw.stripPrefix != "" && strings.HasPrefix(path, rw.stripPrefix) {
+		path = strings.TrimPrefix(path, rw.stripPrefix)
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+
+	for _, rewrite := range rw.regexes {
+		path = rewrite.pattern.ReplaceAllString(path, rewrite.replacement)
+	}
+
+	for _, rewrite := range rw.templates {
+		vars, ok := rewrite.from.matchEscaped(path)
+		if !ok {
+			continue
+		}
+		path = templateVariablePattern.ReplaceAllStringFunc(rewrite.to, func(variable string) string {
+			return vars[templateVariablePattern.FindStringSubmatch(variable)[1]]
+		})
+		break
+	}
+
+	if rw.addPrefix != "" {
+		if path == "/" {
+			path = rw.addPrefix
+		} else {
+			path = rw.addPrefix + path
+		}
+	}
+
+	return path
+}
+
+func escapePath(path string) string {
+	return (&url.URL{Path: path}).EscapedPath()
+}
+
+func (rw *Rewriter) rewriteQuery(query url.Values) url.Values {
+	for _, name := range rw.query.Remove {
+		query.Del(name)
+	}
+	for _, rename := range rw.renames {
+		if values, ok := query[rename.from]; ok {
+			delete(query, rename.from)
+			query[rename.to] = append(query[rename.to], values...)
+		}
+	}
+	for name, value := range rw.query.Add {
+		query.Add(name, value)
+	}
+	return query
+}
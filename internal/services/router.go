@@ -0,0 +1,60 @@
+package services
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"api-gateway/internal/config"
+)
+
+type Router struct {
+	routes []config.RouteConfig
+}
+
+func NewRouter(routes []config.RouteConfig) *Router {
+	sorted := make([]config.RouteConfig, len(routes))
+	copy(sorted, routes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].PathPrefix) > len(sorted[j].PathPrefix)
+	})
+
+	return &Router{routes: sorted}
+}
+
+func (rt *Router) Match(r *http.Request) *config.RouteConfig {
+	for i := range rt.routes {
+		route := &rt.routes[i]
+		if !matchPrefix(r.URL.Path, route.PathPrefix) {
+			continue
+		}
+		if len(route.Methods) > 0 && !containsFold(route.Methods, r.Method) {
+			continue
+		}
+		return route
+	}
+	return nil
+}
+
+func (rt *Router) Routes() []config.RouteConfig {
+	return rt.routes
+}
+
+func matchPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	if strings.HasSuffix(prefix, "/") || len(path) == len(prefix) {
+		return true
+	}
+	return path[len(prefix)] == '/'
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
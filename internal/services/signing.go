@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	SignatureAlgorithm   = "GW1-HMAC-SHA256"
+	SignatureDateHeader  = "X-Gateway-Date"
+	SignatureNonceHeader = "X-Gateway-Nonce"
+	SignatureBodyHeader  = "X-Gateway-Content-SHA256"
+	SignatureDateFormat  = "20060102T150405Z"
+	UnsignedPayload      = "UNSIGNED-PAYLOAD"
+)
+
+type SignatureParams struct {
+	Credential    string
+	SignedHeaders []string
+	Signature     string
+}
+
+func ParseSignatureHeader(header string) (*SignatureParams, error) {
+	if !strings.HasPrefix(header, SignatureAlgorithm+" ") {
+		return nil, fmt.Errorf("unsupported algorithm")
+	}
+
+	params := &SignatureParams{}
+	for _, part := range strings.Split(strings.TrimPrefix(header, SignatureAlgorithm+" "), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed parameter %q", part)
+		}
+		switch name {
+		case "Credential":
+			params.Credential = value
+		case "SignedHeaders":
+			params.SignedHeaders = strings.Split(strings.ToLower(value), ";")
+		case "Signature":
+			params.Signature = value
+		}
+	}
+
+	if params.Credential == "" || params.Signature == "" || len(params.SignedHeaders) == 0 {
+		return nil, fmt.Errorf("missing Credential, SignedHeaders or Signature")
+	}
+
+	return params, nil
+}
+
+func CanonicalRequest(r *http.Request, signedHeaders []string, payloadHash string) string {
+	headers := make([]string, len(signedHeaders))
+	copy(headers, signedHeaders)
+	sort.Strings(headers)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		var value string
+		if name == "host" {
+			value = r.Host
+		} else {
+			value = strings.Join(r.Header.Values(name), ",")
+		}
+		canonicalHeaders.WriteString(name)
+		canonicalHeaders.WriteString(":")
+		canonicalHeaders.WriteString(strings.Join(strings.Fields(value), " "))
+		canonicalHeaders.WriteString("\n")
+	}
+
+	path := r.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		path,
+		canonicalQuery(r.URL.Query()),
+		canonicalHeaders.String(),
+		strings.Join(headers, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+func canonicalQuery(values url.Values) string {
+	var pairs []string
+	for key, vals := range values {
+		for _, val := range vals {
+			pairs = append(pairs, url.QueryEscape(key)+"="+url.QueryEscape(val))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func StringToSign(timestamp, nonce, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	return strings.Join([]string{SignatureAlgorithm, timestamp, nonce, hex.EncodeToString(hash[:])}, "\n")
+}
+
+func ComputeSignature(secret, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type NonceStore struct {
+	client *redis.Client
+}
+
+func NewNonceStore(client *redis.Client) *NonceStore {
+	return &NonceStore{client: client}
+}
+
+func (ns *NonceStore) Claim(ctx context.Context, credential, nonce string, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("hmac_nonce:%s:%s", credential, nonce)
+	ok, err := ns.client.SetNX(ctx, key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("nonce check failed: %w", err)
+	}
+	return ok, nil
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"api-gateway/internal/config"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// CertificateStore serves certificates by SNI and reloads them from disk
+// when the files change.
+type CertificateStore struct {
+	certFiles []string
+	keyFiles  []string
+	interval  time.Duration
+
+	mu       sync.RWMutex
+	certs    []*tls.Certificate
+	modTimes map[string]time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewCertificateStore(cfg config.TLSConfig) (*CertificateStore, error) {
+	if len(cfg.CertFiles) != len(cfg.KeyFiles) {
+		return nil, fmt.Errorf("got %d certificate files but %d key files", len(cfg.CertFiles), len(cfg.KeyFiles))
+	}
+
+	cs := &CertificateStore{
+		certFiles: cfg.CertFiles,
+		keyFiles:  cfg.KeyFiles,
+		interval:  time.Duration(cfg.ReloadIntervalSeconds) * time.Second,
+	}
+	if err := cs.load(); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+func (cs *CertificateStore) load() error {
+	certs := make([]*tls.Certificate, 0, len(cs.certFiles))
+	for i := range cs.certFiles {
+		cert, err := tls.LoadX509KeyPair(cs.certFiles[i], cs.keyFiles[i])
+		if err != nil {
+			return fmt.Errorf("couldn't load certificate %s: %w", cs.certFiles[i], err)
+		}
+		certs = append(certs, &cert)
+	}
+
+	cs.mu.Lock()
+	cs.certs = certs
+	cs.modTimes = cs.stat()
+	cs.mu.Unlock()
+	return nil
+}
+
+func (cs *CertificateStore) stat() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, file := range append(append([]string{}, cs.certFiles...), cs.keyFiles...) {
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+func (cs *CertificateStore) changed() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	current := cs.stat()
+	if len(current) != len(cs.modTimes) {
+		return true
+	}
+	for file, modTime := range current {
+		if !modTime.Equal(cs.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCertificate picks the first certificate that matches the client's SNI
+// name and supported algorithms, falling back to the first one configured.
+func (cs *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if len(cs.certs) == 0 {
+		return nil, fmt.Errorf("no certificates loaded")
+	}
+	for _, cert := range cs.certs {
+		if hello.SupportsCertificate(cert) == nil {
+			return cert, nil
+		}
+	}
+	return cs.certs[0], nil
+}
+
+func (cs *CertificateStore) Start() {
+	if cs.interval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cs.cancel = cancel
+
+	cs.wg.Add(1)
+	go cs.run(ctx)
+}
+
+func (cs *CertificateStore) Stop() {
+	if cs.cancel != nil {
+		cs.cancel()
+	}
+	cs.wg.Wait()
+}
+
+func (cs *CertificateStore) run(ctx context.Context) {
+	defer cs.wg.Done()
+
+	ticker := time.NewTicker(cs.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !cs.changed() {
+				continue
+			}
+			if err := cs.load(); err != nil {
+				log.Printf("Certificate reload failed, keeping the old ones: %v", err)
+				cs.mu.Lock()
+				cs.modTimes = cs.stat()
+				cs.mu.Unlock()
+				continue
+			}
+			log.Printf("Reloaded %d TLS certificates", len(cs.certFiles))
+		}
+	}
+}
+
+func NewServerTLSConfig(cfg config.TLSConfig, store *CertificateStore) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		GetCertificate: store.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	}
+
+	if cfg.MinVersion != "" {
+		version, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q", cfg.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if len(cfg.CipherSuites) > 0 {
+		suites := make(map[string]uint16)
+		for _, suite := range tls.CipherSuites() {
+			suites[suite.Name] = suite.ID
+		}
+		for _, name := range cfg.CipherSuites {
+			id, ok := suites[strings.ToUpper(name)]
+			if !ok {
+				return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+			}
+			tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+		}
+	}
+
+	if cfg.ClientCAFile != "" {
+		pool, err := loadCertPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+
+		switch cfg.ClientAuth {
+		case "", "request":
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		case "require":
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		default:
+			return nil, fmt.Errorf("unknown client auth mode %q", cfg.ClientAuth)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+func newUpstreamTLSConfig(cfg config.UpstreamTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: cfg.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if cfg.CAFile != "" {
+		pool, err := loadCertPool(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("tls needs both cert_file and key_file")
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't load client certificate %s: %w", cfg.CertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", file)
+	}
+	return pool, nil
+}
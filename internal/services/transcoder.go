@@ -0,0 +1,424 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/models"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const maxTranscodeMessageBytes = 4 << 20
+
+type Transcoder struct {
+	bindings []*transcodeBinding
+	types    *dynamicpb.Types
+}
+
+type transcodeBinding struct {
+	httpMethod   string
+	template     *pathTemplate
+	grpcPath     string
+	method       protoreflect.MethodDescriptor
+	body         string
+	responseBody string
+}
+
+func NewTranscoder(cfg config.TranscodeConfig) (*Transcoder, error) {
+	data, err := os.ReadFile(cfg.DescriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read descriptor set: %w", err)
+	}
+
+	var fds descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &fds); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+	files, err := protodesc.NewFiles(&fds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+
+	t := &Transcoder{types: dynamicpb.NewTypes(files)}
+
+	wanted := make(map[string]bool)
+	for _, name := range cfg.Services {
+		wanted[name] = true
+	}
+
+	files.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			service := services.Get(i)
+			if len(wanted) > 0 && !wanted[string(service.FullName())] {
+				continue
+			}
+			methods := service.Methods()
+			for j := 0; j < methods.Len(); j++ {
+				if err = t.addMethod(methods.Get(j)); err != nil {
+					return false
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(t.bindings) == 0 {
+		return nil, fmt.Errorf("descriptor set %s has no google.api.http bindings", cfg.DescriptorSet)
+	}
+
+	sort.SliceStable(t.bindings, func(i, j int) bool {
+		return t.bindings[i].template.literals() > t.bindings[j].template.literals()
+	})
+
+	return t, nil
+}
+
+func (t *Transcoder) addMethod(method protoreflect.MethodDescriptor) error {
+	opts, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok || !proto.HasExtension(opts, annotations.E_Http) {
+		return nil
+	}
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		log.Printf("Skipping streaming method %s for transcoding", method.FullName())
+		return nil
+	}
+
+	rule := proto.GetExtension(opts, annotations.E_Http).(*annotations.HttpRule)
+	for _, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+		httpMethod, pattern := httpRulePattern(r)
+		if pattern == "" {
+			continue
+		}
+		template, err := parsePathTemplate(pattern)
+		if err != nil {
+			return fmt.Errorf("method %s: %w", method.FullName(), err)
+		}
+		t.bindings = append(t.bindings, &transcodeBinding{
+			httpMethod:   httpMethod,
+			template:     template,
+			grpcPath:     fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name()),
+			method:       method,
+			body:         r.GetBody(),
+			responseBody: r.GetResponseBody(),
+		})
+	}
+	return nil
+}
+
+func httpRulePattern(rule *annotations.HttpRule) (string, string) {
+	switch pattern := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return http.MethodGet, pattern.Get
+	case *annotations.HttpRule_Put:
+		return http.MethodPut, pattern.Put
+	case *annotations.HttpRule_Post:
+		return http.MethodPost, pattern.Post
+	case *annotations.HttpRule_Delete:
+		return http.MethodDelete, pattern.Delete
+	case *annotations.HttpRule_Patch:
+		return http.MethodPatch, pattern.Patch
+	case *annotations.HttpRule_Custom:
+		return strings.ToUpper(pattern.Custom.GetKind()), pattern.Custom.GetPath()
+	default:
+		return "", ""
+	}
+}
+
+func (t *Transcoder) match(r *http.Request) (*transcodeBinding, map[string]string) {
+	for _, binding := range t.bindings {
+		if binding.httpMethod != r.Method {
+			continue
+		}
+		if vars, ok := binding.template.match(r.URL.EscapedPath()); ok {
+			return binding, vars
+		}
+	}
+	return nil, nil
+}
+
+func (p *ProxyService) ForwardTranscoded(r *http.Request, route *config.RouteConfig, principal *models.Principal) (*http.Response, error) {
+	transcoder := p.transcoders[route.Transcode]
+	if transcoder == nil {
+		return nil, fmt.Errorf("route %s has no transcoder", route.Name)
+	}
+
+	binding, vars := transcoder.match(r)
+	if binding == nil {
+		return nil, &RequestError{Status: http.StatusNotFound, Message: "No route"}
+	}
+
+	payload, err := binding.requestMessage(r, vars, transcoder.types, p.identity.apiKeyQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(payload)))
+	copy(frame[5:], payload)
+
+	grpcReq := r.Clone(r.Context())
+	grpcReq.Method = http.MethodPost
+	grpcReq.URL = &url.URL{Path: binding.grpcPath}
+	grpcReq.Body = io.NopCloser(bytes.NewReader(frame))
+	grpcReq.ContentLength = int64(len(frame))
+	for _, name := range []string{"Connection", "Upgrade", "Content-Length", "Accept", "Accept-Encoding"} {
+		grpcReq.Header.Del(name)
+	}
+	grpcReq.Header.Set("Content-Type", "application/grpc")
+	grpcReq.Header.Set("Te", "trailers")
+
+	resp, err := p.ForwardRequest(grpcReq, route, principal)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return p.transcodeResponse(resp, binding, transcoder.types)
+}
+
+func (b *transcodeBinding) requestMessage(r *http.Request, vars map[string]string, types *dynamicpb.Types, apiKeyQuery string) ([]byte, error) {
+	msg := dynamicpb.NewMessage(b.method.Input())
+	unmarshal := protojson.UnmarshalOptions{Resolver: types}
+
+	if b.body != "" && r.Body != nil {
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxTranscodeMessageBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxTranscodeMessageBytes {
+			return nil, &RequestError{Status: http.StatusRequestEntityTooLarge, Message: "Request body too large"}
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			if b.body != "*" {
+				fd := findField(msg.Descriptor(), b.body)
+				if fd == nil {
+					return nil, fmt.Errorf("body field %s not found in %s", b.body, msg.Descriptor().FullName())
+				}
+				data = []byte(fmt.Sprintf("{%q:%s}", fd.JSONName(), data))
+			}
+			if err := unmarshal.Unmarshal(data, msg); err != nil {
+				return nil, &RequestError{Status: http.StatusBadRequest, Message: "Invalid request body: " + err.Error()}
+			}
+		}
+	}
+
+	if b.body != "*" {
+		for key, values := range r.URL.Query() {
+			if key == apiKeyQuery || key == b.body || strings.HasPrefix(key, b.body+".") || vars[key] != "" {
+				continue
+			}
+			if err := setField(msg, key, values, types); err != nil && err != errUnknownField {
+				return nil, &RequestError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid query parameter %s: %v", key, err)}
+			}
+		}
+	}
+
+	for field, value := range vars {
+		if err := setField(msg, field, []string{value}, types); err != nil {
+			return nil, &RequestError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid path parameter %s: %v", field, err)}
+		}
+	}
+
+	return proto.Marshal(msg)
+}
+
+func (p *ProxyService) transcodeResponse(resp *http.Response, binding *transcodeBinding, types *dynamicpb.Types) (*http.Response, error) {
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream returned HTTP %d to a gRPC call", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTranscodeMessageBytes+6))
+	if err != nil {
+		return nil, err
+	}
+
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+		message = resp.Header.Get("Grpc-Message")
+	}
+	if status == "" {
+		return nil, fmt.Errorf("gRPC response for %s has no status", binding.grpcPath)
+	}
+	p.metrics.RecordGRPCStatus(GRPCCodeName(status))
+
+	if status != "0" {
+		if decoded, err := url.PathUnescape(message); err == nil {
+			message = decoded
+		}
+		code, _ := strconv.Atoi(status)
+		body, _ := json.Marshal(map[string]string{"error": message, "code": GRPCCodeName(status)})
+		return jsonResponse(HTTPStatusForGRPCCode(code), body), nil
+	}
+
+	if len(data) < 5 {
+		return nil, fmt.Errorf("gRPC response for %s has no message", binding.grpcPath)
+	}
+	if data[0] != 0 {
+		return nil, fmt.Errorf("gRPC response for %s is compressed", binding.grpcPath)
+	}
+	length := binary.BigEndian.Uint32(data[1:5])
+	if int(length) > len(data)-5 {
+		return nil, fmt.Errorf("gRPC response for %s is truncated or too large", binding.grpcPath)
+	}
+
+	msg := dynamicpb.NewMessage(binding.method.Output())
+	if err := proto.Unmarshal(data[5:5+length], msg); err != nil {
+		return nil, fmt.Errorf("invalid gRPC response for %s: %w", binding.grpcPath, err)
+	}
+
+	marshal := protojson.MarshalOptions{Resolver: types, EmitUnpopulated: true}
+	raw, err := marshal.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, raw); err != nil {
+		return nil, err
+	}
+	body := compacted.Bytes()
+
+	if binding.responseBody != "" {
+		fd := findField(msg.Descriptor(), binding.responseBody)
+		if fd == nil {
+			return nil, fmt.Errorf("response_body field %s not found in %s", binding.responseBody, msg.Descriptor().FullName())
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, err
+		}
+		body = fields[fd.JSONName()]
+	}
+
+	return jsonResponse(http.StatusOK, body), nil
+}
+
+func jsonResponse(status int, body []byte) *http.Response {
+	return &http.Response{
+		StatusCode:    status,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+var errUnknownField = fmt.Errorf("unknown field")
+
+func findField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fields := md.Fields()
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return fields.ByJSONName(name)
+}
+
+func setField(msg protoreflect.Message, path string, values []string, types *dynamicpb.Types) error {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		fd := findField(msg.Descriptor(), name)
+		if fd == nil {
+			return errUnknownField
+		}
+		if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return fmt.Errorf("%s is not a message field", name)
+		}
+		msg = msg.Mutable(fd).Message()
+	}
+
+	fd := findField(msg.Descriptor(), names[len(names)-1])
+	if fd == nil {
+		return errUnknownField
+	}
+	if fd.IsMap() {
+		return fmt.Errorf("map fields can't be set from the URL")
+	}
+
+	if fd.IsList() {
+		list := msg.Mutable(fd).List()
+		for _, value := range values {
+			element := list.NewElement()
+			v, err := parseFieldValue(fd, value, element, types)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+		return nil
+	}
+
+	v, err := parseFieldValue(fd, values[len(values)-1], msg.NewField(fd), types)
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, v)
+	return nil
+}
+
+func parseFieldValue(fd protoreflect.FieldDescriptor, value string, empty protoreflect.Value, types *dynamicpb.Types) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BytesKind:
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			data, err = base64.URLEncoding.DecodeString(value)
+		}
+		return protoreflect.ValueOfBytes(data), err
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(value)
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(value, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(value, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(value, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(value, 32)
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(value, 64)
+		return protoreflect.ValueOfFloat64(v), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(value)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		v, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), err
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		unmarshal := protojson.UnmarshalOptions{Resolver: types}
+		err := unmarshal.Unmarshal([]byte(strconv.Quote(value)), empty.Message().Interface())
+		return empty, err
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported field kind %s", fd.Kind())
+	}
+}
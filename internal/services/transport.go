@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"api-gateway/internal/config"
+
+	"golang.org/x/net/http2"
+)
+
+const (
+	ProtocolH2C = "h2c"
+	ProtocolH2  = "h2"
+)
+
+func newTransport(protocol string, timeouts config.TimeoutConfig, tlsConfig *tls.Config) http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   time.Duration(timeouts.ConnectMs) * time.Millisecond,
+		KeepAlive: 30 * time.Second,
+	}
+	responseHeaderTimeout := time.Duration(timeouts.ResponseHeaderMs) * time.Millisecond
+
+	switch protocol {
+	case ProtocolH2C:
+		return &responseHeaderTimeoutTransport{
+			RoundTripper: &http2.Transport{
+				AllowHTTP: true,
+				DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+					return dialer.DialContext(ctx, network, addr)
+				},
+				ReadIdleTimeout: 30 * time.Second,
+				PingTimeout:     15 * time.Second,
+			},
+			timeout: responseHeaderTimeout,
+		}
+	case ProtocolH2:
+		handshakeTimeout := time.Duration(timeouts.TLSHandshakeMs) * time.Millisecond
+		return &responseHeaderTimeoutTransport{
+			RoundTripper: &http2.Transport{
+				TLSClientConfig: tlsConfig,
+				DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+					if handshakeTimeout > 0 {
+						var cancel context.CancelFunc
+						ctx, cancel = context.WithTimeout(ctx, dialer.Timeout+handshakeTimeout)
+						defer cancel()
+					}
+					tlsDialer := &tls.Dialer{NetDialer: dialer, Config: cfg}
+					return tlsDialer.DialContext(ctx, network, addr)
+				},
+				ReadIdleTimeout: 30 * time.Second,
+				PingTimeout:     15 * time.Second,
+			},
+			timeout: responseHeaderTimeout,
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = time.Duration(timeouts.TLSHandshakeMs) * time.Millisecond
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig.Clone()
+	}
+	transport.MaxIdleConns = 200
+	transport.MaxIdleConnsPerHost = 100
+	return transport
+}
+
+// responseHeaderTimeoutTransport gives HTTP/2 transports the same
+// response-header timeout that http.Transport has built in.
+type responseHeaderTimeoutTransport struct {
+	http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *responseHeaderTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.RoundTripper.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(t.timeout, cancel)
+
+	resp, err := t.RoundTripper.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() && req.Context().Err() == nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("%w: timeout awaiting response headers", context.DeadlineExceeded)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: cancel}
+	return resp, nil
+}
@@ -0,0 +1,394 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"api-gateway/internal/config"
+	"api-gateway/internal/models"
+)
+
+var ErrTooManyWebSockets = errors.New("too many concurrent WebSocket connections")
+
+const (
+	closeGoingAway       = 1001
+	closePolicyViolation = 1008
+)
+
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(upgradeType(r.Header), "websocket")
+}
+
+func upgradeType(header http.Header) string {
+	for _, value := range header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return header.Get("Upgrade")
+			}
+		}
+	}
+	return ""
+}
+
+type WebSocketProxy struct {
+	cfg     config.WebSocketConfig
+	metrics *MetricsCollector
+
+	mu       sync.Mutex
+	conns    map[string]int
+	limiters map[string]*messageLimiter
+
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+func NewWebSocketProxy(cfg config.WebSocketConfig, metrics *MetricsCollector) *WebSocketProxy {
+	return &WebSocketProxy{
+		cfg:      cfg,
+		metrics:  metrics,
+		conns:    make(map[string]int),
+		limiters: make(map[string]*messageLimiter),
+		shutdown: make(chan struct{}),
+	}
+}
+
+// Shutdown closes every open WebSocket with a going-away frame.
+func (wp *WebSocketProxy) Shutdown() {
+	wp.shutdownOnce.Do(func() { close(wp.shutdown) })
+}
+
+type WebSocketLease struct {
+	key     string
+	limiter *messageLimiter
+	once    sync.Once
+	proxy   *WebSocketProxy
+}
+
+func (l *WebSocketLease) Release() {
+	l.once.Do(func() {
+		l.proxy.mu.Lock()
+		defer l.proxy.mu.Unlock()
+
+		l.proxy.conns[l.key]--
+		if l.proxy.conns[l.key] <= 0 {
+			delete(l.proxy.conns, l.key)
+			delete(l.proxy.limiters, l.key)
+		}
+	})
+}
+
+func (wp *WebSocketProxy) Acquire(principal *models.Principal) (*WebSocketLease, error) {
+	key := "anonymous"
+	if principal != nil {
+		key = principal.Type + ":" + principal.ID
+	}
+
+	wp.mu.Lock()
+	defer wp.mu.Unlock()
+
+	if wp.cfg.MaxConnectionsPerKey > 0 && wp.conns[key] >= wp.cfg.MaxConnectionsPerKey {
+		wp.metrics.RecordWebSocketRejected()
+		return nil, ErrTooManyWebSockets
+	}
+
+	limiter, ok := wp.limiters[key]
+	if !ok {
+		limiter = newMessageLimiter(wp.cfg.MaxMessagesPerSecond)
+		wp.limiters[key] = limiter
+	}
+	wp.conns[key]++
+
+	return &WebSocketLease{key: key, limiter: limiter, proxy: wp}, nil
+}
+
+func (wp *WebSocketProxy) Proxy(w http.ResponseWriter, resp *http.Response, lease *WebSocketLease) error {
+	backendConn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return fmt.Errorf("backend upgrade connection is not writable")
+	}
+	defer backendConn.Close()
+
+	clientConn, clientBuf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return fmt.Errorf("couldn't hijack client connection: %w", err)
+	}
+	defer clientConn.Close()
+	clientConn.SetDeadline(time.Time{})
+
+	removeHopByHopHeaders(resp.Header)
+	resp.Header.Set("Connection", "Upgrade")
+	resp.Header.Set("Upgrade", "websocket")
+
+	if err := writeSwitchingProtocols(clientBuf.Writer, resp); err != nil {
+		return err
+	}
+
+	wp.metrics.RecordWebSocketOpen()
+	defer wp.metrics.RecordWebSocketClose()
+
+	var lastActivity int64
+	touch := func() { atomic.StoreInt64(&lastActivity, time.Now().UnixNano()) }
+	touch()
+
+	done := make(chan struct{})
+	errs := make(chan error, 2)
+
+	client := &clientWriter{conn: clientConn, frames: frameWriter{w: clientConn}}
+
+	go func() {
+		backend := &frameWriter{w: backendConn, onMessage: func() error {
+			touch()
+			wp.metrics.RecordWebSocketMessage()
+			if !lease.limiter.Allow() {
+				return errMessageRateExceeded
+			}
+			return nil
+		}}
+		_, err := io.Copy(backend, &activityReader{Reader: clientBuf.Reader, touch: touch})
+		if errors.Is(err, errMessageRateExceeded) {
+			client.Close(closePolicyViolation, "message rate exceeded")
+		}
+		errs <- err
+	}()
+	go func() {
+		_, err := io.Copy(client, &activityReader{Reader: backendConn, touch: touch})
+		errs <- err
+	}()
+
+	go func() {
+		idle := time.Duration(wp.cfg.IdleTimeoutSeconds) * time.Second
+		var tick <-chan time.Time
+		if idle > 0 {
+			ticker := time.NewTicker(idle / 4)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for {
+			select {
+			case <-done:
+				return
+			case <-wp.shutdown:
+				backendConn.Close()
+				client.Close(closeGoingAway, "server shutting down")
+				clientConn.Close()
+				return
+			case <-tick:
+				if time.Since(time.Unix(0, atomic.LoadInt64(&lastActivity))) > idle {
+					wp.metrics.RecordWebSocketIdleTimeout()
+					clientConn.Close()
+					backendConn.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	err = <-errs
+	close(done)
+	return ignoreClosed(err)
+}
+
+func writeSwitchingProtocols(w *bufio.Writer, resp *http.Response) error {
+	if _, err := fmt.Fprintf(w, "HTTP/1.1 101 Switching Protocols\r\n"); err != nil {
+		return err
+	}
+	if err := resp.Header.Write(w); err != nil {
+		return err
+	}
+	if _, err := w.WriteString("\r\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func writeCloseFrame(conn net.Conn, code uint16, reason string) {
+	payload := make([]byte, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, code)
+	copy(payload[2:], reason)
+
+	frame := append([]byte{0x88, byte(len(payload))}, payload...)
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	conn.Write(frame)
+}
+
+// clientWriter serializes writes to the client, so the gateway's own close
+// frame goes out between the backend's frames rather than inside one.
+type clientWriter struct {
+	conn net.Conn
+
+	mu     sync.Mutex
+	frames frameWriter
+	closed bool
+}
+
+func (cw *clientWriter) Write(p []byte) (int, error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if cw.closed {
+		return 0, net.ErrClosed
+	}
+	return cw.frames.Write(p)
+}
+
+// Close stops the backend's frames and sends a close frame, unless a frame
+// was left half written, in which case the connection is just dropped.
+func (cw *clientWriter) Close(code uint16, reason string) {
+	// Unblock a write stuck on a slow client.
+	cw.conn.SetWriteDeadline(time.Now().Add(time.Second))
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	if cw.closed {
+		return
+	}
+	cw.closed = true
+	if cw.frames.boundary() {
+		writeCloseFrame(cw.conn, code, reason)
+	}
+}
+
+func ignoreClosed(err error) error {
+	if err == nil || errors.Is(err, net.ErrClosed) || errors.Is(err, io.EOF) || errors.Is(err, errMessageRateExceeded) {
+		return nil
+	}
+	return err
+}
+
+type activityReader struct {
+	io.Reader
+	touch func()
+}
+
+func (r *activityReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.touch()
+	}
+	return n, err
+}
+
+var errMessageRateExceeded = errors.New("message rate exceeded")
+
+type messageLimiter struct {
+	rate int
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newMessageLimiter(rate int) *messageLimiter {
+	return &messageLimiter{rate: rate, tokens: float64(rate), last: time.Now()}
+}
+
+func (ml *messageLimiter) Allow() bool {
+	if ml.rate <= 0 {
+		return true
+	}
+
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	now := time.Now()
+	ml.tokens += now.Sub(ml.last).Seconds() * float64(ml.rate)
+	if ml.tokens > float64(ml.rate) {
+		ml.tokens = float64(ml.rate)
+	}
+	ml.last = now
+
+	if ml.tokens < 1 {
+		return false
+	}
+	ml.tokens--
+	return true
+}
+
+// frameWriter follows a stream of WebSocket frames on its way to w, without
+// buffering payloads. onMessage is called at the start of every data message,
+// and if it fails, that message isn't written.
+type frameWriter struct {
+	w         io.Writer
+	onMessage func() error
+
+	header    []byte
+	remaining uint64
+}
+
+func (fw *frameWriter) Write(p []byte) (int, error) {
+	headerStart := 0
+	for i := 0; i < len(p); {
+		if fw.remaining > 0 {
+			skip := min(uint64(len(p)-i), fw.remaining)
+			fw.remaining -= skip
+			i += int(skip)
+			continue
+		}
+
+		if len(fw.header) == 0 {
+			headerStart = i
+		}
+		fw.header = append(fw.header, p[i])
+		i++
+
+		size, complete := frameHeaderSize(fw.header)
+		if !complete || len(fw.header) < size {
+			continue
+		}
+
+		opcode := fw.header[0] & 0x0f
+		fw.remaining = framePayloadLength(fw.header)
+		fw.header = fw.header[:0]
+
+		if fw.onMessage != nil && (opcode == 0x1 || opcode == 0x2) {
+			if err := fw.onMessage(); err != nil {
+				n, _ := fw.w.Write(p[:headerStart])
+				return n, err
+			}
+		}
+	}
+	return fw.w.Write(p)
+}
+
+func (fw *frameWriter) boundary() bool {
+	return len(fw.header) == 0 && fw.remaining == 0
+}
+
+func frameHeaderSize(header []byte) (int, bool) {
+	if len(header) < 2 {
+		return 0, false
+	}
+
+	size := 2
+	switch header[1] & 0x7f {
+	case 126:
+		size += 2
+	case 127:
+		size += 8
+	}
+	if header[1]&0x80 != 0 {
+		size += 4
+	}
+	return size, true
+}
+
+func framePayloadLength(header []byte) uint64 {
+	switch length := header[1] & 0x7f; length {
+	case 126:
+		return uint64(binary.BigEndian.Uint16(header[2:4]))
+	case 127:
+		return binary.BigEndian.Uint64(header[2:10])
+	default:
+		return uint64(length)
+	}
+}
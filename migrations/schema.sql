@@ -5,6 +5,7 @@ CREATE TABLE IF NOT EXISTS api_keys (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
     key VARCHAR(255) UNIQUE NOT NULL,
     name VARCHAR(255) NOT NULL,
+    signing_secret VARCHAR(255),
     rate_limit_per_minute INTEGER NOT NULL DEFAULT 100,
     rate_limit_per_hour INTEGER NOT NULL DEFAULT 5000,
     is_active BOOLEAN NOT NULL DEFAULT true,
@@ -13,6 +14,9 @@ CREATE TABLE IF NOT EXISTS api_keys (
 
 CREATE INDEX idx_api_keys_key ON api_keys(key);
 
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS signing_secret VARCHAR(255);
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS max_body_bytes BIGINT;
+
 -- Request logs table
 CREATE TABLE IF NOT EXISTS request_logs (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),